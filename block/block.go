@@ -6,9 +6,11 @@ package block
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"go/ast"
 	"go/token"
+	"strings"
 )
 
 type Graph struct {
@@ -48,15 +50,7 @@ func (v *builderVisitor) Visit(x ast.Node) ast.Visitor {
 		}
 	}
 	switch x := x.(type) {
-	case *ast.BlockStmt, *ast.IfStmt, *ast.ForStmt, *ast.RangeStmt, *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.CaseClause, *ast.CommClause:
-		b := &Block{
-			Depth:  v.current.Depth + 1,
-			ID:     v.builder.nblock,
-			Parent: v.current,
-			Root:   x,
-		}
-		v.builder.nblock++
-		v.current.Child = append(v.current.Child, b)
+	case *ast.BlockStmt, *ast.IfStmt, *ast.ForStmt, *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.CaseClause, *ast.CommClause:
 		skipBlock := false
 		switch x.(type) {
 		case *ast.SwitchStmt, *ast.TypeSwitchStmt:
@@ -64,7 +58,20 @@ func (v *builderVisitor) Visit(x ast.Node) ast.Visitor {
 			// where variables can be declared. Elide.
 			skipBlock = true
 		}
-		return &builderVisitor{builder: v.builder, current: b, skipBlock: skipBlock}
+		return &builderVisitor{builder: v.builder, current: v.newBlock(x), skipBlock: skipBlock}
+	case *ast.RangeStmt:
+		// The range expression is evaluated once, before the iteration
+		// variables are in scope, so it belongs to the enclosing block.
+		// This matters when it is an iterator written as a function literal.
+		ast.Walk(v, x.X)
+		inner := &builderVisitor{builder: v.builder, current: v.newBlock(x)}
+		for _, y := range []ast.Expr{x.Key, x.Value} {
+			if y != nil {
+				ast.Walk(inner, y)
+			}
+		}
+		ast.Walk(inner, x.Body)
+		return nil
 	case *ast.LabeledStmt:
 		v.builder.g.Label[x.Label.Name] = x
 	case *ast.BranchStmt:
@@ -83,6 +90,19 @@ func (v *builderVisitor) Visit(x ast.Node) ast.Visitor {
 	return v
 }
 
+// newBlock adds a block rooted at x as the last child of the current block.
+func (v *builderVisitor) newBlock(x ast.Node) *Block {
+	b := &Block{
+		Depth:  v.current.Depth + 1,
+		ID:     v.builder.nblock,
+		Parent: v.current,
+		Root:   x,
+	}
+	v.builder.nblock++
+	v.current.Child = append(v.current.Child, b)
+	return b
+}
+
 func Build(fset *token.FileSet, x ast.Node) *Graph {
 	g := &Graph{
 		Start:    &Block{},
@@ -128,3 +148,75 @@ func (g *Graph) Dump() []byte {
 	dump(g.Start)
 	return buf.Bytes()
 }
+
+// blocks returns the blocks of g in the depth-first order used by Dump.
+func (g *Graph) blocks() []*Block {
+	var list []*Block
+	stack := []*Block{g.Start}
+	for len(stack) > 0 {
+		b := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		list = append(list, b)
+		for i := len(b.Child) - 1; i >= 0; i-- {
+			stack = append(stack, b.Child[i])
+		}
+	}
+	return list
+}
+
+func (g *Graph) label(b *Block) string {
+	label := fmt.Sprintf("%d: depth=%d", b.ID, b.Depth)
+	if b.Root != nil {
+		pos := g.FileSet.Position(b.Root.Pos())
+		label += fmt.Sprintf(" root=%T %s:%d", b.Root, pos.Filename, pos.Line)
+	}
+	return label
+}
+
+type jsonBlock struct {
+	ID     int    `json:"id"`
+	Depth  int    `json:"depth"`
+	Parent *int   `json:"parent,omitempty"`
+	Child  []int  `json:"child,omitempty"`
+	Root   string `json:"root,omitempty"`
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line,omitempty"`
+}
+
+// JSON returns a JSON encoding of the blocks in g, in the same order as Dump.
+func (g *Graph) JSON() ([]byte, error) {
+	list := []jsonBlock{}
+	for _, b := range g.blocks() {
+		jb := jsonBlock{ID: b.ID, Depth: b.Depth}
+		if b.Parent != nil {
+			jb.Parent = &b.Parent.ID
+		}
+		for _, c := range b.Child {
+			jb.Child = append(jb.Child, c.ID)
+		}
+		if b.Root != nil {
+			pos := g.FileSet.Position(b.Root.Pos())
+			jb.Root = fmt.Sprintf("%T", b.Root)
+			jb.File = pos.Filename
+			jb.Line = pos.Line
+		}
+		list = append(list, jb)
+	}
+	return json.MarshalIndent(list, "", "\t")
+}
+
+// Mermaid returns a Mermaid flowchart of the block tree in g.
+func (g *Graph) Mermaid() []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "flowchart TD\n")
+	list := g.blocks()
+	for _, b := range list {
+		fmt.Fprintf(&buf, "\tb%d[\"%s\"]\n", b.ID, strings.Replace(g.label(b), `"`, "#quot;", -1))
+	}
+	for _, b := range list {
+		for _, c := range b.Child {
+			fmt.Fprintf(&buf, "\tb%d --> b%d\n", b.ID, c.ID)
+		}
+	}
+	return buf.Bytes()
+}
@@ -48,5 +48,23 @@ func TestBlockGolden(t *testing.T) {
 			t.Errorf("%s: wrong graph; have %s.dump.xxx, want %s.dump", file, base, base)
 			continue
 		}
+
+		js, err := g.JSON()
+		if err != nil {
+			t.Errorf("%s: %v", file, err)
+			continue
+		}
+		golden, _ = ioutil.ReadFile(base + ".json")
+		if !bytes.Equal(js, golden) {
+			ioutil.WriteFile(base+".json.xxx", js, 0666)
+			t.Errorf("%s: wrong JSON; have %s.json.xxx, want %s.json", file, base, base)
+		}
+
+		mmd := g.Mermaid()
+		golden, _ = ioutil.ReadFile(base + ".mmd")
+		if !bytes.Equal(mmd, golden) {
+			ioutil.WriteFile(base+".mmd.xxx", mmd, 0666)
+			t.Errorf("%s: wrong Mermaid; have %s.mmd.xxx, want %s.mmd", file, base, base)
+		}
 	}
 }
@@ -0,0 +1,16 @@
+package p
+
+func f() {
+	for i := range 10 {
+		use(i)
+	}
+	for x := range func(yield func(int) bool) {
+		if !yield(1) {
+			return
+		}
+	} {
+		if x > 0 {
+			break
+		}
+	}
+}
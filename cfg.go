@@ -0,0 +1,172 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/types"
+	"io"
+	"sort"
+	"strings"
+
+	"rsc.io/grind/block"
+	"rsc.io/grind/flow"
+	"rsc.io/grind/grinder"
+	"rsc.io/grind/liveness"
+)
+
+// runCfg implements the cfg subcommand, which writes the
+// control flow graph of a single function to w.
+func runCfg(w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("cfg", flag.ContinueOnError)
+	name := fs.String("func", "", "write the graph of the function or method (T.Name) with this `name`")
+	format := fs.String("format", "dot", "output `format`: dot, json, or mermaid (text also allowed with -blocks)")
+	annotate := fs.String("annotate", "", "label edges with the variables live along them (live) or the definitions reaching them (reach)")
+	blocks := fs.Bool("blocks", false, "write the tree of lexical blocks instead of the control flow graph")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: grind cfg -func=name [-format=dot|json|mermaid] [-annotate=live|reach] [-blocks] file.go...\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *name == "" || fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("cfg: need -func and at least one file")
+	}
+	for _, file := range fs.Args() {
+		if !strings.HasSuffix(file, ".go") {
+			return fmt.Errorf("cfg: %s is not a .go file", file)
+		}
+	}
+
+	var out []byte
+	var err error
+	var found []string
+	c := grinder.Context{
+		Logf:  ctxt.Logf,
+		Funcs: []string{*name},
+		Grinders: []grinder.Func{func(c *grinder.Context, pkg *grinder.Package) {
+			grinder.GrindFuncDecls(c, pkg, func(c *grinder.Context, pkg *grinder.Package, edit *grinder.EditBuffer, fn *ast.FuncDecl) {
+				found = append(found, grinder.FuncName(fn))
+				out, err = exportFunc(pkg, fn, *format, *annotate, *blocks)
+			})
+		}},
+	}
+	if pkg := c.GrindFiles(fs.Args()...); pkg == nil || c.Errors {
+		return fmt.Errorf("cfg: cannot load %s", strings.Join(fs.Args(), " "))
+	}
+	switch len(found) {
+	case 0:
+		return fmt.Errorf("cfg: function %s not found", *name)
+	case 1:
+		// ok
+	default:
+		return fmt.Errorf("cfg: -func=%s matches %s; use T.Name for methods", *name, strings.Join(found, ", "))
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// exportFunc returns the graph of fn in the given format.
+func exportFunc(pkg *grinder.Package, fn *ast.FuncDecl, format, annotate string, blocks bool) ([]byte, error) {
+	if fn.Body == nil {
+		return nil, fmt.Errorf("cfg: %s has no body", grinder.FuncName(fn))
+	}
+	fset := pkg.FileSet
+
+	if blocks {
+		if annotate != "" {
+			return nil, fmt.Errorf("cfg: cannot use -annotate with -blocks")
+		}
+		g := block.Build(fset, fn.Body)
+		switch format {
+		case "json":
+			return g.JSON()
+		case "mermaid":
+			return g.Mermaid(), nil
+		case "text":
+			return g.Dump(), nil
+		}
+		return nil, fmt.Errorf("cfg: unknown -format %q for -blocks: want json, mermaid, or text", format)
+	}
+
+	var g *flow.Graph
+	var edge func(src, dst ast.Node) string
+	switch annotate {
+	case "":
+		deferred := make(map[ast.Node]bool)
+		ast.Inspect(fn.Body, func(x ast.Node) bool {
+			if d, ok := x.(*ast.DeferStmt); ok {
+				deferred[d.Call] = true
+			}
+			return true
+		})
+		g = flow.Build(fset, fn.Body, func(x ast.Node) bool {
+			switch x.(type) {
+			case *ast.BlockStmt:
+				return false
+			case ast.Stmt:
+				return true
+			}
+			return deferred[x]
+		})
+
+	case "live":
+		l := liveness.Compute(fset, &pkg.Info, fn)
+		g = l.Graph
+		edge = func(src, dst ast.Node) string {
+			return varNames(l.LiveIn(dst))
+		}
+
+	case "reach":
+		d := flow.ReachingDefs(fset, fn.Body, nil, nil)
+		g = d.Graph
+		var objs []*ast.Object
+		for obj := range d.Refs {
+			objs = append(objs, obj)
+		}
+		sort.Slice(objs, func(i, j int) bool { return objs[i].Pos() < objs[j].Pos() })
+		edge = func(src, dst ast.Node) string {
+			var list []string
+			for _, obj := range objs {
+				var lines []string
+				for _, def := range d.After(src, obj) {
+					lines = append(lines, fmt.Sprint(fset.Position(def.Pos()).Line))
+				}
+				if len(lines) > 0 {
+					list = append(list, obj.Name+":"+strings.Join(lines, ","))
+				}
+			}
+			return strings.Join(list, " ")
+		}
+
+	default:
+		return nil, fmt.Errorf("cfg: unknown -annotate %q: want live or reach", annotate)
+	}
+
+	switch format {
+	case "dot":
+		return g.Dot(edge), nil
+	case "json":
+		return g.JSON(edge)
+	case "mermaid":
+		return g.Mermaid(edge), nil
+	}
+	return nil, fmt.Errorf("cfg: unknown -format %q: want dot, json, or mermaid", format)
+}
+
+func varNames(list []*types.Var) string {
+	var names []string
+	for _, v := range list {
+		names = append(names, v.Name())
+	}
+	return strings.Join(names, " ")
+}
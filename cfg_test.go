@@ -0,0 +1,49 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestCfg(t *testing.T) {
+	tests := []struct {
+		args   []string
+		golden string // expected output file, or "" if cfg should fail
+	}{
+		{[]string{"-func=G"}, ""}, // matches both G and T.G
+		{[]string{"-func=H"}, ""},
+		{[]string{"-func=T.G", "-blocks", "-annotate=live"}, ""},
+		{[]string{"-func=F", "-format=svg"}, ""},
+		{[]string{"-func=F", "-annotate=avail"}, ""},
+		{[]string{"-func=F"}, "testdata/cfg/a.dot"},
+		{[]string{"-func=F", "-format=mermaid", "-annotate=live"}, "testdata/cfg/a.live.mmd"},
+		{[]string{"-func=F", "-format=json", "-annotate=reach"}, "testdata/cfg/a.reach.json"},
+		{[]string{"-func=F", "-format=text", "-blocks"}, "testdata/cfg/a.blocks"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		args := append(tt.args, "testdata/cfg/a.go")
+		err := runCfg(&buf, args)
+		if tt.golden == "" {
+			if err == nil {
+				t.Errorf("cfg %s: unexpected success", strings.Join(args, " "))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("cfg %s: %v", strings.Join(args, " "), err)
+			continue
+		}
+		want, _ := ioutil.ReadFile(tt.golden)
+		if !bytes.Equal(buf.Bytes(), want) {
+			ioutil.WriteFile(tt.golden+".xxx", buf.Bytes(), 0666)
+			t.Errorf("cfg %s: wrong output; have %s.xxx, want %s", strings.Join(args, " "), tt.golden, tt.golden)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package constcond simplifies statements whose conditions are constant.
+package constcond
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"strings"
+
+	"rsc.io/grind/grinder"
+)
+
+func Grind(ctxt *grinder.Context, pkg *grinder.Package) {
+	if pkg.TypesError != nil {
+		// Without type information, we can't tell which conditions are constant.
+		if ctxt.Verbose {
+			ctxt.Logf("%s: cannot fold constant conditions without type information", pkg.ImportPath)
+		}
+		return
+	}
+	grinder.GrindFuncDecls(ctxt, pkg, grindFunc)
+}
+
+func grindFunc(ctxt *grinder.Context, pkg *grinder.Package, edit *grinder.EditBuffer, fn *ast.FuncDecl) {
+	if fn.Body == nil {
+		return
+	}
+	f := &folder{
+		pkg:    pkg,
+		edit:   edit,
+		del:    grinder.NewDeletions(pkg, fn),
+		parent: make(map[ast.Stmt]ast.Node),
+		funcs:  map[*ast.BlockStmt]*ast.FuncType{fn.Body: fn.Type},
+	}
+	ast.Inspect(fn.Body, f.visit)
+}
+
+type folder struct {
+	pkg  *grinder.Package
+	edit *grinder.EditBuffer
+	del  *grinder.Deletions
+
+	// parent maps a statement to the node holding it:
+	// a block, a case or comm clause, a labeled statement,
+	// or, for an else if, the if statement.
+	parent map[ast.Stmt]ast.Node
+
+	// funcs maps a function body to its type,
+	// which holds the scope of the body's declarations.
+	funcs map[*ast.BlockStmt]*ast.FuncType
+}
+
+func (f *folder) visit(x ast.Node) bool {
+	switch x := x.(type) {
+	case *ast.FuncLit:
+		f.funcs[x.Body] = x.Type
+	case *ast.BlockStmt:
+		f.setParent(x, x.List)
+	case *ast.CaseClause:
+		f.setParent(x, x.Body)
+	case *ast.CommClause:
+		f.setParent(x, x.Body)
+	case *ast.LabeledStmt:
+		f.parent[x.Stmt] = x
+	case *ast.IfStmt:
+		if x.Else != nil {
+			f.parent[x.Else] = x
+		}
+		if v, ok := f.constant(x.Cond); ok && f.foldIf(x, v) {
+			// The statement has been replaced; its body is handled next time.
+			return false
+		}
+	case *ast.ForStmt:
+		if v, ok := f.constant(x.Cond); ok && f.foldFor(x, v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *folder) setParent(x ast.Node, list []ast.Stmt) {
+	for _, y := range list {
+		f.parent[y] = x
+	}
+}
+
+// constant reports the value of the condition x, if it is a constant.
+func (f *folder) constant(x ast.Expr) (value, ok bool) {
+	if x == nil {
+		return false, false
+	}
+	tv := f.pkg.Info.Types[x]
+	if tv.Value == nil || tv.Value.Kind() != constant.Bool {
+		return false, false
+	}
+	return constant.BoolVal(tv.Value), true
+}
+
+// foldIf replaces the if statement x, whose condition has the constant value v,
+// with its init statement and the branch that runs.
+// It reports whether it replaced x.
+func (f *folder) foldIf(x *ast.IfStmt, v bool) bool {
+	kept, dropped := ast.Stmt(x.Body), x.Else
+	if !v {
+		kept, dropped = x.Else, x.Body
+	}
+	var body []ast.Stmt
+	switch kept := kept.(type) {
+	case *ast.BlockStmt:
+		body = kept.List
+	case *ast.IfStmt:
+		body = []ast.Stmt{kept}
+	}
+	if len(body) == 0 && x.Init == nil {
+		return f.remove(x)
+	}
+
+	deleted := []ast.Node{x.Cond}
+	if dropped != nil {
+		deleted = append(deleted, dropped)
+	}
+	if !f.del.Add(deleted...) {
+		return false
+	}
+
+	var code []string
+	if x.Init != nil {
+		code = append(code, f.edit.TextAt(x.Init.Pos(), x.Init.End()))
+	}
+	switch kept := kept.(type) {
+	case *ast.BlockStmt:
+		if len(kept.List) > 0 {
+			code = append(code, strings.TrimSpace(f.edit.TextAt(kept.Lbrace+1, kept.Rbrace)))
+		}
+	case *ast.IfStmt:
+		code = append(code, f.edit.TextAt(kept.Pos(), kept.End()))
+	}
+	text := strings.Join(code, "\n")
+	// An if statement can stand in for x as is, even after an else.
+	_, chain := kept.(*ast.IfStmt)
+	if x.Init != nil {
+		chain = false
+		body = append([]ast.Stmt{x.Init}, body...)
+	}
+	if !chain && !f.canHoist(x, body) {
+		text = "{\n" + text + "\n}"
+	}
+	f.edit.Replace(x.Pos(), x.End(), text)
+	return true
+}
+
+// foldFor simplifies the for statement x, whose condition has the constant value v.
+// A loop that always continues loses its condition.
+// A loop that never runs is replaced by its init statement.
+// It reports whether it replaced all of x.
+func (f *folder) foldFor(x *ast.ForStmt, v bool) bool {
+	if v {
+		if f.del.Add(x.Cond) {
+			f.edit.Delete(x.Cond.Pos(), x.Cond.End())
+		}
+		return false
+	}
+	if x.Init == nil {
+		return f.remove(x)
+	}
+	if _, ok := f.parent[x].(*ast.LabeledStmt); ok {
+		// The label would be left on the init statement.
+		return false
+	}
+	deleted := []ast.Node{x.Cond, x.Body}
+	if x.Post != nil {
+		deleted = append(deleted, x.Post)
+	}
+	if !f.del.Add(deleted...) {
+		return false
+	}
+	text := f.edit.TextAt(x.Init.Pos(), x.Init.End())
+	if !f.canHoist(x, []ast.Stmt{x.Init}) {
+		text = "{\n" + text + "\n}"
+	}
+	f.edit.Replace(x.Pos(), x.End(), text)
+	return true
+}
+
+// remove deletes the statement x and any labels on it, if that is safe.
+func (f *folder) remove(x ast.Stmt) bool {
+	stmt, parent := f.outer(x)
+	var list []ast.Stmt
+	var start token.Pos
+	switch parent := parent.(type) {
+	default:
+		return false
+	case *ast.IfStmt:
+		// An else if: delete the else too.
+		if !f.del.Add(x) {
+			return false
+		}
+		f.edit.Delete(parent.Body.End(), x.End())
+		return true
+	case *ast.BlockStmt:
+		list, start = parent.List, parent.Lbrace+1
+	case *ast.CaseClause:
+		list, start = parent.Body, parent.Colon+1
+	case *ast.CommClause:
+		list, start = parent.Body, parent.Colon+1
+	}
+	if !f.del.Add(stmt) {
+		return false
+	}
+	for i, y := range list {
+		if y == stmt && i > 0 {
+			start = f.edit.End(list[i-1])
+		}
+	}
+	f.edit.Delete(f.edit.AfterComment(start), f.edit.AfterComment(f.edit.End(stmt)))
+	return true
+}
+
+// outer returns x with any labels on it, along with the node holding it.
+func (f *folder) outer(x ast.Stmt) (ast.Stmt, ast.Node) {
+	for {
+		l, ok := f.parent[x].(*ast.LabeledStmt)
+		if !ok {
+			return x, f.parent[x]
+		}
+		x = l
+	}
+}
+
+// canHoist reports whether the statements list, taken from inside x,
+// can replace x in the statement list holding it without their
+// declarations conflicting with the names used there.
+func (f *folder) canHoist(x ast.Stmt, list []ast.Stmt) bool {
+	stmt, parent := f.outer(x)
+	if grinder.BlockList(parent) == nil {
+		return false
+	}
+	names := make(map[string]bool)
+	for _, y := range list {
+		switch y := grinder.Unlabel(y).(type) {
+		case *ast.AssignStmt:
+			if y.Tok == token.DEFINE {
+				for _, lhs := range y.Lhs {
+					if id, ok := lhs.(*ast.Ident); ok {
+						names[id.Name] = true
+					}
+				}
+			}
+		case *ast.DeclStmt:
+			for _, spec := range y.Decl.(*ast.GenDecl).Specs {
+				switch spec := spec.(type) {
+				case *ast.ValueSpec:
+					for _, id := range spec.Names {
+						names[id.Name] = true
+					}
+				case *ast.TypeSpec:
+					names[spec.Name.Name] = true
+				}
+			}
+		}
+	}
+	delete(names, "_")
+	if len(names) == 0 {
+		return true
+	}
+
+	scope := f.pkg.Info.Scopes[parent]
+	if b, ok := parent.(*ast.BlockStmt); ok && f.funcs[b] != nil {
+		scope = f.pkg.Info.Scopes[f.funcs[b]]
+	}
+	for name := range names {
+		if scope == nil || scope.Lookup(name) != nil {
+			return false
+		}
+	}
+	ok := true
+	ast.Inspect(parent, func(y ast.Node) bool {
+		if y == stmt {
+			return false
+		}
+		if id, isID := y.(*ast.Ident); isID && names[id.Name] {
+			ok = false
+		}
+		return ok
+	})
+	return ok
+}
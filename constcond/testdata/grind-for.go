@@ -0,0 +1,38 @@
+package p
+
+import "fmt"
+
+const debug = false
+
+func f() int { return 1 }
+
+func loops() {
+	for 1 != 0 {
+		if f() > 1 {
+			break
+		}
+	}
+	for i := 0; true; i++ {
+		if i > 10 {
+			break
+		}
+	}
+	for false {
+		fmt.Println("never")
+	}
+	for f(); debug; {
+		fmt.Println("never")
+	}
+L:
+	for false {
+		continue L
+	}
+	fmt.Println("done")
+}
+
+func forever() int {
+	for true {
+		fmt.Println("again")
+	}
+	return 0
+}
@@ -0,0 +1,58 @@
+package p
+
+import "fmt"
+
+const debug = false
+
+func f() int { return 1 }
+
+func ifs() {
+	if 0 != 0 {
+		fmt.Println("never")
+	}
+	if 1 != 0 {
+		fmt.Println("always")
+	}
+	if debug && false {
+		fmt.Println("debug")
+	} else {
+		fmt.Println("not debug")
+	}
+	if debug {
+		fmt.Println("debug")
+	} else if x := f(); x > 0 {
+		fmt.Println(x)
+	}
+}
+
+func chain(x int) {
+	if x > 0 {
+		fmt.Println("positive")
+	} else if debug {
+		fmt.Println("debug")
+	} else {
+		fmt.Println("other")
+	}
+	if x > 1 {
+		fmt.Println("big")
+	} else if false {
+		fmt.Println("never")
+	}
+}
+
+func nested() {
+	if true {
+		if debug {
+			fmt.Println("debug")
+		}
+		fmt.Println("always")
+	}
+}
+
+func results(x int) int {
+	if true {
+		return x
+	} else {
+		return 0
+	}
+}
@@ -0,0 +1,38 @@
+package p
+
+import "fmt"
+
+func f() int { return 1 }
+
+func inits() {
+	if y := f(); true {
+		fmt.Println(y)
+	}
+	if f(); false {
+		fmt.Println("never")
+	}
+	x := 2
+	if x := f(); 1 == 1 {
+		fmt.Println(x)
+	}
+	fmt.Println(x)
+}
+
+func shadow() {
+	x := 1
+	if true {
+		x := 2
+		fmt.Println(x)
+	}
+	fmt.Println(x)
+}
+
+func lastUse() {
+	x := 1
+	if false {
+		fmt.Println(x)
+	}
+	if z := f(); false {
+		fmt.Println(z)
+	}
+}
@@ -6,8 +6,11 @@ package deadcode
 
 import (
 	"go/ast"
+	"go/constant"
+	"go/token"
 
 	"rsc.io/grind/block"
+	"rsc.io/grind/flow"
 	"rsc.io/grind/grinder"
 )
 
@@ -16,58 +19,151 @@ func Grind(ctxt *grinder.Context, pkg *grinder.Package) {
 }
 
 func grindFunc(ctxt *grinder.Context, pkg *grinder.Package, edit *grinder.EditBuffer, fn *ast.FuncDecl) {
+	walkDead(pkg, fn, func(start token.Pos, dead []ast.Stmt) {
+		edit.Delete(edit.AfterComment(start), edit.AfterComment(edit.End(dead[len(dead)-1])))
+	})
+}
+
+// Count returns the number of unreachable statements that Grind would delete from pkg.
+// Statements nested inside a deleted statement are not counted separately.
+func Count(ctxt *grinder.Context, pkg *grinder.Package) int {
+	n := 0
+	grinder.GrindFuncDecls(ctxt, pkg, func(ctxt *grinder.Context, pkg *grinder.Package, edit *grinder.EditBuffer, fn *ast.FuncDecl) {
+		walkDead(pkg, fn, func(start token.Pos, dead []ast.Stmt) {
+			n += len(dead)
+		})
+	})
+	return n
+}
+
+// A run is a sequence of unreachable statements in a statement list.
+type run struct {
+	start token.Pos // end of the preceding statement, or the start of the list
+	list  []ast.Stmt
+}
+
+// walkDead calls f for each run of unreachable statements in fn
+// that can be deleted, passing the position where the run begins,
+// just after the preceding statement or the opening of the list.
+//
+// A statement is unreachable if no path through the flow graph of
+// fn (or of the function literal containing it) leads to it,
+// taking constant conditions into account.
+func walkDead(pkg *grinder.Package, fn *ast.FuncDecl, f func(start token.Pos, dead []ast.Stmt)) {
 	if fn.Body == nil {
 		return
 	}
+	cfg := &flow.Config{
+		Constant: func(cond ast.Expr) (value, ok bool) {
+			tv := pkg.Info.Types[cond]
+			if tv.Value == nil || tv.Value.Kind() != constant.Bool {
+				return false, false
+			}
+			return constant.BoolVal(tv.Value), true
+		},
+	}
+	g := cfg.Build(pkg.FileSet, fn.Body, func(x ast.Node) bool {
+		_, ok := x.(ast.Stmt)
+		return ok
+	})
 	blocks := block.Build(pkg.FileSet, fn.Body)
-	ast.Inspect(fn.Body, func(x ast.Node) bool {
-		var list []ast.Stmt
-		switch x := x.(type) {
-		default:
-			return true
-		case *ast.BlockStmt:
-			list = x.List
-		case *ast.CommClause:
-			list = x.Body
-		case *ast.CaseClause:
-			list = x.Body
-		}
 
-		for i := 0; i < len(list); i++ {
-			x := list[i]
-			if grinder.IsTerminatingStmt(blocks, x) {
+	var runs []*run
+	dead := make(map[ast.Stmt]bool)
+	var walk func(g *flow.Graph, typ *ast.FuncType, body *ast.BlockStmt)
+	walk = func(g *flow.Graph, typ *ast.FuncType, body *ast.BlockStmt) {
+		ast.Inspect(body, func(x ast.Node) bool {
+			if x, ok := x.(ast.Stmt); ok && dead[x] {
+				return false
+			}
+			var start token.Pos
+			var list []ast.Stmt
+			switch x := x.(type) {
+			default:
+				return true
+			case *ast.FuncLit:
+				walk(g.Funcs[x], x.Type, x.Body)
+				return false
+			case *ast.BlockStmt:
+				if len(x.List) > 0 && isClause(x.List[0]) {
+					// The body of a switch or select; see the clauses themselves.
+					return true
+				}
+				start, list = x.Lbrace+1, x.List
+			case *ast.CommClause:
+				start, list = x.Colon+1, x.Body
+			case *ast.CaseClause:
+				start, list = x.Colon+1, x.Body
+			}
+
+			for i := 0; i < len(list); i++ {
+				if isReachable(g, list[i]) {
+					continue
+				}
 				end := i + 1
-				for end < len(list) && !isGotoTarget(blocks, list[end]) {
+				for end < len(list) && !isReachable(g, list[end]) {
 					end++
 				}
-				if end > i+1 {
-					edit.Delete(edit.End(x), edit.End(list[end-1]))
-					i = end - 1 // after i++, next iteration starts at end
+				r := &run{start: start, list: list[i:end]}
+				if i > 0 {
+					r.start = list[i-1].End()
+				}
+				// A function with results must still end in a terminating statement.
+				last := r.list[len(r.list)-1]
+				if typ.Results != nil && end == len(list) && grinder.IsTerminatingStmt(blocks, last) &&
+					(i == 0 || !grinder.IsTerminatingStmt(blocks, list[i-1])) {
+					r.list = r.list[:len(r.list)-1]
+				}
+				if len(r.list) > 0 {
+					runs = append(runs, r)
+					for _, x := range r.list {
+						dead[x] = true
+					}
 				}
+				i = end - 1 // after i++, next iteration starts at end
 			}
-		}
-		return true
-	})
-}
+			return true
+		})
+	}
+	walk(g, fn.Type, fn.Body)
 
-func fallsThrough(x ast.Stmt) bool {
-	switch x.(type) {
-	case *ast.ReturnStmt, *ast.BranchStmt:
-		return false
+	// Keep the runs that must stay for fn to compile.
+	del := grinder.NewDeletions(pkg, fn)
+	for _, r := range runs {
+		if del.Add(stmts(r.list)...) {
+			f(r.start, r.list)
+		}
 	}
-	// TODO: for loop, switch etc with certain bodies
-	return true
 }
 
-func isGotoTarget(blocks *block.Graph, x ast.Stmt) bool {
+// isReachable reports whether the flow graph g reaches x.
+// A label that is not the target of a goto has no node of its own,
+// so it is reachable when the statement it labels is.
+func isReachable(g *flow.Graph, x ast.Stmt) bool {
 	for {
-		y, ok := x.(*ast.LabeledStmt)
+		if _, ok := g.Preds[x]; ok {
+			return true
+		}
+		l, ok := x.(*ast.LabeledStmt)
 		if !ok {
 			return false
 		}
-		if len(blocks.Goto[y.Label.Name]) > 0 {
-			return true
-		}
-		x = y.Stmt
+		x = l.Stmt
+	}
+}
+
+func isClause(x ast.Stmt) bool {
+	switch x.(type) {
+	case *ast.CaseClause, *ast.CommClause:
+		return true
+	}
+	return false
+}
+
+func stmts(list []ast.Stmt) []ast.Node {
+	nodes := make([]ast.Node, len(list))
+	for i, x := range list {
+		nodes[i] = x
 	}
+	return nodes
 }
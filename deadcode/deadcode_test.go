@@ -14,3 +14,7 @@ import (
 func TestDeadcode(t *testing.T) {
 	grindtest.TestGlob(t, "testdata/grind-*.go", []grinder.Func{Grind})
 }
+
+func TestDecls(t *testing.T) {
+	grindtest.TestGlob(t, "testdata/decls-*.go", []grinder.Func{GrindDecls})
+}
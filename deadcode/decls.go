@@ -0,0 +1,389 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package deadcode
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"rsc.io/grind/grinder"
+)
+
+// A Decl is an unexported package-level declaration that nothing refers to.
+type Decl struct {
+	Kind string // "func", "type", "const", or "var"
+	Name string
+	Pos  token.Pos
+
+	file *ast.File
+	decl *ast.GenDecl  // for a type, const, or var
+	spec ast.Spec      // for a type, const, or var
+	fn   *ast.FuncDecl // for a func
+}
+
+// UnusedDecls returns the unexported package-level functions, types,
+// constants, and variables in pkg that are never referred to, in source order.
+// A declaration referred to only by itself or by other unused declarations
+// is unused too. Methods, init functions, and the main function of
+// package main are never reported, nor are declarations carrying
+// //go: or //export directives.
+func UnusedDecls(pkg *grinder.Package) []Decl {
+	return unusedDecls(pkg, nil)
+}
+
+// unusedDecls is like UnusedDecls but omits the declarations for
+// which keep returns true. The references in those declarations,
+// which stay in the program, count as uses.
+func unusedDecls(pkg *grinder.Package, keep func(*Decl) bool) []Decl {
+	if pkg.Types == nil {
+		return nil
+	}
+	var decls []Decl
+	for i, f := range pkg.Files {
+		if strings.Contains(pkg.Src(pkg.Filenames[i]), "\n//line ") {
+			// Don't bother cleaning generated code.
+			continue
+		}
+		edit := grinder.NewEditBuffer(pkg, pkg.Filenames[i], f)
+		for _, d := range f.Decls {
+			if hasDirective(edit, d) {
+				continue
+			}
+			switch d := d.(type) {
+			case *ast.FuncDecl:
+				if d.Recv != nil || d.Name.Name == "init" || d.Name.Name == "main" && pkg.Types.Name() == "main" {
+					continue
+				}
+				decls = append(decls, Decl{Kind: "func", Name: d.Name.Name, Pos: d.Name.Pos(), file: f, fn: d})
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					if hasDirective(edit, spec) {
+						continue
+					}
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						decls = append(decls, Decl{Kind: "type", Name: spec.Name.Name, Pos: spec.Name.Pos(), file: f, decl: d, spec: spec})
+					case *ast.ValueSpec:
+						for _, id := range spec.Names {
+							decls = append(decls, Decl{Kind: d.Tok.String(), Name: id.Name, Pos: id.Pos(), file: f, decl: d, spec: spec})
+						}
+					}
+				}
+			}
+		}
+	}
+
+	// Find the candidates: unexported, and with an object.
+	cand := decls[:0]
+	for _, d := range decls {
+		if d.Name == "_" || ast.IsExported(d.Name) {
+			continue
+		}
+		cand = append(cand, d)
+	}
+	decls = cand
+
+	// Find the uses of package-level objects
+	// and the candidates they appear in, if any.
+	type span struct {
+		node  ast.Node
+		decls []int
+	}
+	var spans []span
+	for i, d := range decls {
+		if n := len(spans); n > 0 && spans[n-1].node == d.node() {
+			spans[n-1].decls = append(spans[n-1].decls, i)
+			continue
+		}
+		spans = append(spans, span{d.node(), []int{i}})
+	}
+	type use struct {
+		obj types.Object
+		in  []int
+	}
+	var uses []use
+	for id, obj := range pkg.Info.Uses {
+		if obj.Parent() != pkg.Types.Scope() {
+			continue
+		}
+		k := sort.Search(len(spans), func(k int) bool { return spans[k].node.End() > id.Pos() })
+		var in []int
+		if k < len(spans) && spans[k].node.Pos() <= id.Pos() {
+			in = spans[k].decls
+		}
+		uses = append(uses, use{obj, in})
+	}
+
+	// Mark unused declarations until nothing changes.
+	unused := make([]bool, len(decls))
+	kept := make([]bool, len(decls))
+	for changed := true; changed; {
+		changed = false
+		used := make(map[types.Object]bool)
+		for _, u := range uses {
+			inside := false
+			for _, i := range u.in {
+				if unused[i] || decls[i].Name == u.obj.Name() {
+					// A use from within the declaration itself
+					// or from within an unused declaration.
+					inside = true
+				}
+			}
+			if !inside {
+				used[u.obj] = true
+			}
+		}
+		for i := range decls {
+			if unused[i] || kept[i] || used[pkg.Types.Scope().Lookup(decls[i].Name)] {
+				continue
+			}
+			if keep != nil && keep(&decls[i]) {
+				kept[i] = true
+				continue
+			}
+			unused[i] = true
+			changed = true
+		}
+	}
+
+	var list []Decl
+	for i, d := range decls {
+		if unused[i] {
+			list = append(list, d)
+		}
+	}
+	return list
+}
+
+// node returns the syntax for d: its function or its spec.
+func (d *Decl) node() ast.Node {
+	if d.fn != nil {
+		return d.fn
+	}
+	return d.spec
+}
+
+// hasDirective reports whether the comments before x
+// include a //go: or //export directive.
+func hasDirective(edit *grinder.EditBuffer, x ast.Node) bool {
+	for _, line := range strings.Split(edit.TextAt(edit.BeforeComments(x.Pos()), x.Pos()), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "//go:") || strings.HasPrefix(line, "//export ") {
+			return true
+		}
+	}
+	return false
+}
+
+// GrindDecls deletes the unused declarations in pkg that can be
+// deleted safely, along with any imports used only by them.
+// It keeps declarations named in the package's test files,
+// variables whose initializers might have side effects,
+// and constants whose deletion would change the value of iota
+// for the constants after them.
+// GrindDecls does nothing when grinding is restricted to
+// particular functions or lines.
+func GrindDecls(ctxt *grinder.Context, pkg *grinder.Package) {
+	if pkg.TypesError != nil || len(ctxt.Lines) > 0 || len(ctxt.Funcs) > 0 {
+		return
+	}
+	tests := testNames(pkg)
+
+	// Group deletions by file and by declaration.
+	del := make(map[*ast.File]map[*ast.GenDecl][]ast.Spec)
+	var fns []Decl
+	keep := func(d *Decl) bool {
+		if vs, ok := d.spec.(*ast.ValueSpec); ok && len(vs.Names) > 1 {
+			// Deleting only some of the names is not worth the trouble.
+			return true
+		}
+		return tests[d.Name] || !d.canDelete(pkg)
+	}
+	for _, d := range unusedDecls(pkg, keep) {
+		if d.fn != nil {
+			fns = append(fns, d)
+			continue
+		}
+		if del[d.file] == nil {
+			del[d.file] = make(map[*ast.GenDecl][]ast.Spec)
+		}
+		del[d.file][d.decl] = append(del[d.file][d.decl], d.spec)
+	}
+
+	for i, filename := range pkg.Filenames {
+		file := pkg.Files[i]
+		var deleted []ast.Node
+		edit := grinder.NewEditBuffer(pkg, filename, file)
+		for _, d := range fns {
+			if d.file == file {
+				deleteNode(edit, d.fn)
+				deleted = append(deleted, d.fn)
+			}
+		}
+		for decl, specs := range del[file] {
+			if len(specs) == len(decl.Specs) {
+				deleteNode(edit, decl)
+				deleted = append(deleted, decl)
+				continue
+			}
+			for _, spec := range specs {
+				deleteNode(edit, spec)
+				deleted = append(deleted, spec)
+			}
+		}
+		if len(deleted) == 0 {
+			continue
+		}
+		deleteImports(pkg, edit, file, deleted)
+		pkg.Rewrite(filename, edit.Apply())
+	}
+}
+
+// canDelete reports whether deleting d leaves the meaning of the
+// rest of the package unchanged.
+func (d *Decl) canDelete(pkg *grinder.Package) bool {
+	spec, ok := d.spec.(*ast.ValueSpec)
+	if !ok {
+		return true
+	}
+	if d.decl.Tok == token.VAR {
+		for _, v := range spec.Values {
+			if hasEffects(pkg, v) {
+				return false
+			}
+		}
+		return true
+	}
+
+	// The constants after d in its group must not depend on iota.
+	after := false
+	for _, s := range d.decl.Specs {
+		if s == d.spec {
+			after = true
+			continue
+		}
+		if !after {
+			continue
+		}
+		s := s.(*ast.ValueSpec)
+		if len(s.Values) == 0 {
+			return false
+		}
+		for _, v := range s.Values {
+			if mentionsIota(v) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// hasEffects reports whether evaluating x might call a function or receive from a channel.
+func hasEffects(pkg *grinder.Package, x ast.Expr) bool {
+	effects := false
+	ast.Inspect(x, func(y ast.Node) bool {
+		switch y := y.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.CallExpr:
+			if !pkg.Info.Types[y.Fun].IsType() {
+				effects = true
+			}
+		case *ast.UnaryExpr:
+			if y.Op == token.ARROW {
+				effects = true
+			}
+		}
+		return !effects
+	})
+	return effects
+}
+
+func mentionsIota(x ast.Expr) bool {
+	found := false
+	ast.Inspect(x, func(y ast.Node) bool {
+		if id, ok := y.(*ast.Ident); ok && id.Name == "iota" {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// deleteNode deletes x and the comments before it.
+func deleteNode(edit *grinder.EditBuffer, x ast.Node) {
+	edit.DeleteLine(edit.BeforeComments(x.Pos()), x.End())
+}
+
+// deleteImports deletes the imports in file used only by the deleted nodes.
+func deleteImports(pkg *grinder.Package, edit *grinder.EditBuffer, file *ast.File, deleted []ast.Node) {
+	isDeleted := func(p token.Pos) bool {
+		for _, x := range deleted {
+			if x.Pos() <= p && p < x.End() {
+				return true
+			}
+		}
+		return false
+	}
+	uses := make(map[types.Object]int)
+	for id, obj := range pkg.Info.Uses {
+		if _, ok := obj.(*types.PkgName); ok && file.Pos() <= id.Pos() && id.Pos() < file.End() && !isDeleted(id.Pos()) {
+			uses[obj]++
+		}
+	}
+	for _, d := range file.Decls {
+		gen, ok := d.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			continue
+		}
+		var unused []ast.Spec
+		for _, spec := range gen.Specs {
+			spec := spec.(*ast.ImportSpec)
+			obj := pkg.Info.Implicits[spec]
+			if spec.Name != nil {
+				obj = pkg.Info.Defs[spec.Name]
+			}
+			if obj != nil && obj.Name() != "_" && obj.Name() != "." && uses[obj] == 0 {
+				unused = append(unused, spec)
+			}
+		}
+		if len(unused) == len(gen.Specs) && len(unused) > 0 {
+			deleteNode(edit, gen)
+			continue
+		}
+		for _, spec := range unused {
+			deleteNode(edit, spec)
+		}
+	}
+}
+
+// testNames returns the identifiers appearing in the test files
+// in the directory of pkg, which may refer to its declarations.
+func testNames(pkg *grinder.Package) map[string]bool {
+	names := make(map[string]bool)
+	if len(pkg.Filenames) == 0 {
+		return names
+	}
+	files, _ := filepath.Glob(filepath.Join(filepath.Dir(pkg.Filenames[0]), "*_test.go"))
+	fset := token.NewFileSet()
+	for _, file := range files {
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			continue
+		}
+		ast.Inspect(f, func(x ast.Node) bool {
+			if id, ok := x.(*ast.Ident); ok {
+				names[id.Name] = true
+			}
+			return true
+		})
+	}
+	return names
+}
@@ -0,0 +1,50 @@
+package p
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Exported is exported, so it is kept.
+func Exported() {
+	used()
+}
+
+func used() {}
+
+// unused is never called.
+func unused() {
+	helper()
+}
+
+// helper is called only by unused.
+func helper() {
+	fmt.Println(strings.ToUpper(name))
+}
+
+type point struct{ x, y int }
+
+const (
+	red = iota
+	green
+	blue
+)
+
+const (
+	small = 1
+	large = 2
+	huge  = 3
+)
+
+const name = "p"
+
+var (
+	counter int
+	table   = map[string]int{}
+	loaded  = load()
+)
+
+func load() bool { return true }
+
+//go:noinline
+func directive() {}
@@ -0,0 +1,47 @@
+package p
+
+import (
+	"fmt"
+	"strings"
+)
+
+const debug = false
+
+func vars() {
+	x := 1
+	if debug {
+		fmt.Println(x)
+	}
+	y := 2
+	if debug {
+		y++
+	}
+	z := 3
+	if debug {
+		fmt.Println(z)
+		z = 4
+	}
+	fmt.Println(z)
+}
+
+func results() int {
+	for true {
+	}
+	println()
+	return 1
+}
+
+func decl() int {
+	for {
+		break
+	}
+	return 2
+	v := 3
+	return v
+}
+
+func imports() {
+	if debug {
+		fmt.Println(strings.ToUpper("x"))
+	}
+}
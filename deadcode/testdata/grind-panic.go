@@ -0,0 +1,14 @@
+package p
+
+func f(x int) int {
+	if x < 0 {
+		panic("negative")
+		x = -x
+	}
+	return x
+}
+
+func g(panic func(string)) {
+	panic("not the builtin")
+	println()
+}
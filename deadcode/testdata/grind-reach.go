@@ -0,0 +1,57 @@
+package p
+
+const debug = false
+
+func use(int)
+
+func constant(x int) {
+	if debug {
+		use(x) // trace
+		use(-x)
+	}
+	if !debug {
+		use(1)
+	} else {
+		use(2)
+	}
+	for false {
+		use(3)
+	}
+	use(4)
+}
+
+func loop(x int) {
+	{
+		for {
+			if x > 0 {
+				use(x)
+				continue
+			}
+			x++
+		}
+	}
+	// Never reached.
+	use(5)
+}
+
+func label(x int) {
+	if debug {
+		goto L
+	}
+	use(x)
+	return // keep this comment
+
+	// Only reached by the goto above.
+L:
+	use(6)
+}
+
+func closure() {
+	f := func() int {
+		for {
+		}
+		use(7)
+		return 1
+	}
+	use(f())
+}
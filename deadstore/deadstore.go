@@ -0,0 +1,487 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package deadstore removes assignments whose values are never read
+// and variables that are only ever assigned.
+package deadstore
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"rsc.io/grind/grinder"
+	"rsc.io/grind/liveness"
+)
+
+func Grind(ctxt *grinder.Context, pkg *grinder.Package) {
+	if pkg.TypesError != nil {
+		// Without type information, we can't tell which stores are dead.
+		if ctxt.Verbose {
+			ctxt.Logf("%s: cannot remove dead stores without type information", pkg.ImportPath)
+		}
+		return
+	}
+	grinder.GrindFuncDecls(ctxt, pkg, grindFunc)
+}
+
+func grindFunc(ctxt *grinder.Context, pkg *grinder.Package, edit *grinder.EditBuffer, fn *ast.FuncDecl) {
+	if fn.Body == nil {
+		return
+	}
+	g := &grind{
+		pkg:       pkg,
+		edit:      edit,
+		del:       grinder.NewDeletions(pkg, fn),
+		assign:    make(map[*ast.Ident]*ast.AssignStmt),
+		spec:      make(map[*ast.Ident]*ast.ValueSpec),
+		decl:      make(map[*ast.ValueSpec]*ast.DeclStmt),
+		blankRead: make(map[*ast.Ident]*ast.AssignStmt),
+		refs:      make(map[*types.Var][]*ast.Ident),
+		blank:     make(map[*ast.Ident]bool),
+		deadInit:  make(map[*ast.ValueSpec]bool),
+		unused:    make(map[*ast.ValueSpec]bool),
+		drop:      make(map[*ast.AssignStmt]bool),
+		rangeVar:  make(map[*ast.Ident]*ast.RangeStmt),
+	}
+	g.scan(fn.Body)
+	g.findUnused(fn.Body)
+	funcs := []ast.Node{fn}
+	ast.Inspect(fn.Body, func(x ast.Node) bool {
+		if x, ok := x.(*ast.FuncLit); ok {
+			funcs = append(funcs, x)
+		}
+		return true
+	})
+	for _, f := range funcs {
+		g.findDead(liveness.Compute(pkg.FileSet, &pkg.Info, f), deferredResults(&pkg.Info, f))
+	}
+	g.rewrite(fn.Body)
+}
+
+type grind struct {
+	pkg  *grinder.Package
+	edit *grinder.EditBuffer
+	del  *grinder.Deletions
+
+	// What the function contains.
+	assign    map[*ast.Ident]*ast.AssignStmt // identifiers assigned by = or :=
+	spec      map[*ast.Ident]*ast.ValueSpec  // identifiers declared by var
+	decl      map[*ast.ValueSpec]*ast.DeclStmt
+	blankRead map[*ast.Ident]*ast.AssignStmt // identifiers read only by _ = x
+	refs      map[*types.Var][]*ast.Ident    // identifiers referring to each local variable
+	rangeVar  map[*ast.Ident]*ast.RangeStmt  // key and value identifiers declared by range
+
+	// What to change.
+	blank    map[*ast.Ident]bool      // assigned identifiers to replace with _
+	deadInit map[*ast.ValueSpec]bool  // var declarations whose initial values are never read
+	unused   map[*ast.ValueSpec]bool  // var declarations to delete
+	drop     map[*ast.AssignStmt]bool // _ = x statements to delete
+}
+
+// scan records the assignments, declarations, and variable references in body.
+func (g *grind) scan(body *ast.BlockStmt) {
+	info := &g.pkg.Info
+	ast.Inspect(body, func(x ast.Node) bool {
+		switch x := x.(type) {
+		case *ast.AssignStmt:
+			if x.Tok != token.ASSIGN && x.Tok != token.DEFINE {
+				break
+			}
+			for _, y := range x.Lhs {
+				if id, ok := y.(*ast.Ident); ok {
+					g.assign[id] = x
+				}
+			}
+			if len(x.Lhs) == 1 && len(x.Rhs) == 1 && isBlank(x.Lhs[0]) && x.Tok == token.ASSIGN {
+				if id, ok := x.Rhs[0].(*ast.Ident); ok {
+					g.blankRead[id] = x
+				}
+			}
+		case *ast.RangeStmt:
+			if x.Tok != token.DEFINE {
+				break
+			}
+			for _, y := range []ast.Expr{x.Key, x.Value} {
+				if id, ok := y.(*ast.Ident); ok {
+					g.rangeVar[id] = x
+				}
+			}
+		case *ast.DeclStmt:
+			gen, ok := x.Decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.VAR {
+				break
+			}
+			for _, spec := range gen.Specs {
+				spec := spec.(*ast.ValueSpec)
+				g.decl[spec] = x
+				for _, id := range spec.Names {
+					g.spec[id] = spec
+				}
+			}
+		case *ast.Ident:
+			obj := info.Defs[x]
+			if obj == nil {
+				obj = info.Uses[x]
+			}
+			if v, ok := obj.(*types.Var); ok && !v.IsField() && body.Pos() <= v.Pos() && v.Pos() < body.End() {
+				g.refs[v] = append(g.refs[v], x)
+			}
+		}
+		return true
+	})
+}
+
+// findUnused finds the variables declared in body that are
+// only assigned and read by _ = x statements, and marks them for deletion.
+func (g *grind) findUnused(body *ast.BlockStmt) {
+	info := &g.pkg.Info
+	ast.Inspect(body, func(x ast.Node) bool {
+		id, ok := x.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		v, ok := info.Defs[id].(*types.Var)
+		if !ok || v.IsField() {
+			return true
+		}
+		spec := g.spec[id]
+		switch {
+		case g.assign[id] != nil && g.assign[id].Tok == token.DEFINE:
+			// x := ...
+		case spec != nil && len(spec.Names) == 1 && len(g.decl[spec].Decl.(*ast.GenDecl).Specs) == 1:
+			// var x ...
+		default:
+			return true
+		}
+
+		var nodes []ast.Node
+		var drops []*ast.AssignStmt
+		for _, ref := range g.refs[v] {
+			switch {
+			case ref == id || g.assign[ref] != nil:
+				nodes = append(nodes, ref)
+			case g.blankRead[ref] != nil:
+				nodes = append(nodes, g.blankRead[ref])
+				drops = append(drops, g.blankRead[ref])
+			default:
+				// A real use.
+				return true
+			}
+		}
+		if !g.del.Add(nodes...) {
+			return true
+		}
+		for _, ref := range g.refs[v] {
+			if g.assign[ref] != nil {
+				g.blank[ref] = true
+			}
+		}
+		for _, s := range drops {
+			g.drop[s] = true
+		}
+		if spec != nil {
+			g.unused[spec] = true
+		}
+		return true
+	})
+}
+
+// findDead marks the assignments in the function analyzed by l
+// whose values are never read. It leaves alone the assignments
+// to the variables in keep.
+func (g *grind) findDead(l *liveness.Info, keep map[*types.Var]bool) {
+	info := &g.pkg.Info
+	for x := range l.Graph.Preds {
+		switch x := x.(type) {
+		case *ast.Ident:
+			s := g.assign[x]
+			if s == nil || g.blank[x] || isBlank(x) || s.Tok == token.DEFINE && info.Defs[x] != nil {
+				// Not an assignment, or one that declares the variable.
+				continue
+			}
+			if v, ok := info.Uses[x].(*types.Var); ok && !keep[v] && !l.IsLiveOut(x, v) {
+				g.blank[x] = true
+			}
+		case *ast.DeclStmt:
+			gen := x.Decl.(*ast.GenDecl)
+			if gen.Tok != token.VAR || len(gen.Specs) != 1 {
+				continue
+			}
+			spec := gen.Specs[0].(*ast.ValueSpec)
+			if g.unused[spec] || spec.Type == nil || len(spec.Names) != 1 || len(spec.Values) != 1 {
+				continue
+			}
+			v, ok := info.Defs[spec.Names[0]].(*types.Var)
+			if ok && !l.IsLiveOut(x, v) && isPure(info, spec.Values[0]) && g.del.Add(spec.Values[0]) {
+				g.deadInit[spec] = true
+			}
+		}
+	}
+}
+
+// deferredResults returns the named results of the function f
+// if f defers a call. A deferred call that recovers from a panic
+// can return the results as they were when the panic happened,
+// and liveness does not model the panics that index expressions,
+// pointer dereferences, divisions, and calls can cause.
+func deferredResults(info *types.Info, f ast.Node) map[*types.Var]bool {
+	var typ *ast.FuncType
+	var body *ast.BlockStmt
+	switch f := f.(type) {
+	case *ast.FuncDecl:
+		typ, body = f.Type, f.Body
+	case *ast.FuncLit:
+		typ, body = f.Type, f.Body
+	}
+	if typ.Results == nil {
+		return nil
+	}
+	hasDefer := false
+	ast.Inspect(body, func(x ast.Node) bool {
+		switch x.(type) {
+		case *ast.FuncLit:
+			return false // defers there are the literal's own
+		case *ast.DeferStmt:
+			hasDefer = true
+		}
+		return !hasDefer
+	})
+	if !hasDefer {
+		return nil
+	}
+	results := make(map[*types.Var]bool)
+	for _, field := range typ.Results.List {
+		for _, id := range field.Names {
+			if v, ok := info.Defs[id].(*types.Var); ok {
+				results[v] = true
+			}
+		}
+	}
+	return results
+}
+
+// rewrite edits the statements in body as marked.
+func (g *grind) rewrite(body *ast.BlockStmt) {
+	info := &g.pkg.Info
+	edit := g.edit
+	ast.Inspect(body, func(x ast.Node) bool {
+		switch x := x.(type) {
+		case *ast.AssignStmt:
+			if g.drop[x] {
+				edit.DeleteLine(x.Pos(), x.End())
+				return false
+			}
+			g.rewriteAssign(x)
+		case *ast.DeclStmt:
+			gen, ok := x.Decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.VAR {
+				break
+			}
+			spec := gen.Specs[0].(*ast.ValueSpec)
+			switch {
+			case g.deadInit[spec]:
+				// var x T = v becomes var x T.
+				edit.Delete(spec.Type.End(), spec.Values[0].End())
+			case g.unused[spec]:
+				if len(spec.Values) == 0 || len(spec.Values) == 1 && isPure(info, spec.Values[0]) && g.del.Add(spec.Values[0]) {
+					edit.DeleteLine(x.Pos(), x.End())
+					return false
+				}
+				// Keep the initializer for its side effects.
+				prefix := "_ = "
+				if len(spec.Values) == 1 && isCallStmt(info, spec.Values[0]) {
+					prefix = ""
+				}
+				edit.Replace(x.Pos(), spec.Values[0].Pos(), prefix)
+			}
+		}
+		return true
+	})
+}
+
+// rewriteAssign replaces the marked identifiers assigned by s with _.
+// If that leaves s assigning nothing, rewriteAssign deletes s,
+// keeping any function calls or channel receives on the right-hand side.
+func (g *grind) rewriteAssign(s *ast.AssignStmt) {
+	info := &g.pkg.Info
+	edit := g.edit
+	changed := false
+	allBlank := true
+	define := false // s still declares a variable
+	for _, x := range s.Lhs {
+		id, ok := x.(*ast.Ident)
+		switch {
+		case ok && g.blank[id]:
+			changed = true
+		case !isBlank(x):
+			allBlank = false
+			if ok && s.Tok == token.DEFINE && info.Defs[id] != nil {
+				define = true
+			}
+		}
+	}
+	if !changed {
+		return
+	}
+
+	if allBlank {
+		pure := true
+		var rhs []ast.Node
+		for _, x := range s.Rhs {
+			pure = pure && isPure(info, x)
+			rhs = append(rhs, x)
+		}
+		if pure && g.del.Add(rhs...) {
+			edit.DeleteLine(s.Pos(), s.End())
+			return
+		}
+		if len(s.Rhs) == 1 && g.dropRangeVar(s.Rhs[0]) {
+			edit.DeleteLine(s.Pos(), s.End())
+			return
+		}
+		if len(s.Rhs) == 1 && isCallStmt(info, s.Rhs[0]) {
+			edit.Delete(s.Pos(), s.Rhs[0].Pos())
+			return
+		}
+	}
+
+	for _, x := range s.Lhs {
+		if id, ok := x.(*ast.Ident); ok && g.blank[id] {
+			edit.Replace(id.Pos(), id.End(), "_")
+		}
+	}
+	if s.Tok == token.DEFINE && !define {
+		edit.Replace(s.TokPos, s.TokPos+token.Pos(len(":=")), "=")
+	}
+}
+
+// dropRangeVar removes from its range clause the key or value variable x,
+// if the statement being deleted holds its only use.
+// It reports whether it removed x.
+func (g *grind) dropRangeVar(x ast.Expr) bool {
+	id, ok := x.(*ast.Ident)
+	if !ok {
+		return false
+	}
+	v, ok := g.pkg.Info.Uses[id].(*types.Var)
+	if !ok || len(g.refs[v]) != 2 {
+		return false
+	}
+	def := g.refs[v][0]
+	r := g.rangeVar[def]
+	if r == nil || g.pkg.Info.Defs[def] != v {
+		return false
+	}
+	edit := g.edit
+	switch {
+	case def == r.Key && r.Value == nil:
+		// for i := range x becomes for range x.
+		edit.Delete(r.Key.Pos(), r.TokPos+token.Pos(len(":=")))
+	case def == r.Key:
+		edit.Replace(def.Pos(), def.End(), "_")
+	case isBlank(r.Key):
+		// for _, v := range x becomes for range x.
+		edit.Delete(r.Key.Pos(), r.TokPos+token.Pos(len(":=")))
+	default:
+		edit.Delete(r.Key.End(), r.Value.End())
+	}
+	return true
+}
+
+func isBlank(x ast.Expr) bool {
+	id, ok := x.(*ast.Ident)
+	return ok && id.Name == "_"
+}
+
+// isPure reports whether evaluating x can have no effect
+// beyond computing its value: it makes no calls, receives,
+// or memory accesses that might panic.
+func isPure(info *types.Info, x ast.Expr) bool {
+	if tv, ok := info.Types[x]; ok && tv.Value != nil {
+		return true
+	}
+	switch x := x.(type) {
+	case *ast.Ident, *ast.BasicLit:
+		return true
+	case *ast.ParenExpr:
+		return isPure(info, x.X)
+	case *ast.UnaryExpr:
+		return x.Op != token.ARROW && isPure(info, x.X)
+	case *ast.BinaryExpr:
+		switch x.Op {
+		case token.QUO, token.REM, token.SHL, token.SHR:
+			// Division by zero and negative shifts panic.
+			return false
+		}
+		return isPure(info, x.X) && isPure(info, x.Y)
+	case *ast.CompositeLit:
+		for _, elt := range x.Elts {
+			if !isPure(info, elt) {
+				return false
+			}
+		}
+		return true
+	case *ast.KeyValueExpr:
+		return isPure(info, x.Key) && isPure(info, x.Value)
+	case *ast.SelectorExpr:
+		sel, ok := info.Selections[x]
+		if !ok {
+			// A qualified identifier.
+			return true
+		}
+		return sel.Kind() == types.FieldVal && !sel.Indirect() && isPure(info, x.X)
+	case *ast.CallExpr:
+		tv := info.Types[x.Fun]
+		if tv.IsType() && len(x.Args) == 1 {
+			// A conversion.
+			return isPure(info, x.Args[0])
+		}
+		if id, ok := x.Fun.(*ast.Ident); ok && tv.IsBuiltin() {
+			switch id.Name {
+			case "new":
+				return true
+			case "len", "cap":
+				return isPure(info, x.Args[0])
+			case "make":
+				// Only a negative or huge size panics.
+				for _, arg := range x.Args[1:] {
+					if tv := info.Types[arg]; tv.Value == nil {
+						return false
+					}
+				}
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isCallStmt reports whether x can stand alone as an expression statement.
+func isCallStmt(info *types.Info, x ast.Expr) bool {
+	switch x := x.(type) {
+	case *ast.ParenExpr:
+		return isCallStmt(info, x.X)
+	case *ast.UnaryExpr:
+		return x.Op == token.ARROW
+	case *ast.CallExpr:
+		tv := info.Types[x.Fun]
+		if tv.IsType() {
+			return false
+		}
+		if tv.IsBuiltin() {
+			id, ok := x.Fun.(*ast.Ident)
+			if !ok {
+				return false
+			}
+			switch id.Name {
+			case "clear", "close", "copy", "delete", "panic", "print", "println", "recover":
+				return true
+			}
+			return false
+		}
+		return true
+	}
+	return false
+}
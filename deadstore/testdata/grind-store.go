@@ -0,0 +1,104 @@
+package p
+
+import "fmt"
+
+func f() int { return 1 }
+
+func g() (int, error) { return 1, nil }
+
+func overwritten() {
+	x := 1
+	x = 2
+	x = 3
+	fmt.Println(x)
+}
+
+func calls() {
+	x := 1
+	fmt.Println(x)
+	x = f()
+	y := 1
+	fmt.Println(y)
+	y = x + 1
+}
+
+func multi() {
+	x, err := g()
+	if err != nil {
+		return
+	}
+	fmt.Println(x)
+	x, err = g()
+	fmt.Println(x)
+}
+
+func loop(n int) int {
+	sum := 0
+	i := 0
+	for i = 0; i < n; i++ {
+		sum += i
+	}
+	i = n
+	return sum
+}
+
+func param(n int) int {
+	n = 2
+	return 1
+}
+
+func named() (r int) {
+	r = 1
+	return
+}
+
+func closure() func() int {
+	x := 1
+	x = 2
+	return func() int { return x }
+}
+
+func address() *int {
+	x := 1
+	p := &x
+	x = 2
+	return p
+}
+
+func varInit() {
+	var x int = 0
+	x = f()
+	fmt.Println(x)
+}
+
+func recovered(a []int) (n int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = nil
+		}
+	}()
+	n = 1
+	n = a[5]
+	return
+}
+
+func rangeKey(a []int) int {
+	x := 0
+	for i := range a {
+		x = i
+	}
+	x = 1
+	for i, v := range a {
+		x = i
+		fmt.Println(v)
+	}
+	for _, v := range a {
+		x = v
+	}
+	for i, v := range a {
+		x = v
+		fmt.Println(i)
+	}
+	x = 2
+	return x
+}
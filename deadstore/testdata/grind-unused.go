@@ -0,0 +1,38 @@
+package p
+
+import "fmt"
+
+func f() int { return 1 }
+
+func g() (int, error) { return 1, nil }
+
+func blank() {
+	x := 1
+	_ = x
+	var y int
+	y = f()
+	_ = y
+	var z = f() * 2
+	_ = z
+}
+
+func partial() {
+	v, err := g()
+	_ = v
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+func keepLast(a int) {
+	x := a
+	_ = x
+}
+
+func ch(c chan int) {
+	x := <-c
+	_ = x
+	y := make([]int, 3)
+	y = nil
+	_ = y
+}
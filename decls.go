@@ -0,0 +1,35 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"rsc.io/grind/deadcode"
+	"rsc.io/grind/grinder"
+)
+
+// reportDecls writes to w the unused declarations
+// in the packages or files in args, without rewriting them.
+func reportDecls(w io.Writer, args []string) {
+	report := ctxt
+	report.Grinders = []grinder.Func{func(ctxt *grinder.Context, pkg *grinder.Package) {
+		for _, d := range deadcode.UnusedDecls(pkg) {
+			fmt.Fprintf(w, "%s: unused %s %s\n", pkg.FileSet.Position(d.Pos), d.Kind, d.Name)
+		}
+	}}
+	if strings.HasSuffix(args[0], ".go") {
+		report.GrindFiles(args...)
+	} else {
+		for _, path := range args {
+			report.GrindPackage(path)
+		}
+	}
+	if report.Errors {
+		ctxt.Errors = true
+	}
+}
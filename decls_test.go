@@ -0,0 +1,28 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestReportDecls(t *testing.T) {
+	var buf bytes.Buffer
+	reportDecls(&buf, []string{"testdata/decls/a.go"})
+	if ctxt.Errors {
+		t.Fatal("report failed")
+	}
+	want := "testdata/decls/a.go:12:6: unused func unused\n" +
+		"testdata/decls/a.go:16:6: unused func helper\n" +
+		"testdata/decls/a.go:20:6: unused func recursive\n" +
+		"testdata/decls/a.go:27:6: unused type point\n" +
+		"testdata/decls/a.go:29:6: unused type shape\n" +
+		"testdata/decls/a.go:35:7: unused const limit\n" +
+		"testdata/decls/a.go:39:5: unused var counter\n"
+	if have := buf.String(); have != want {
+		t.Errorf("reportDecls:\nhave:\n%s\nwant:\n%s", have, want)
+	}
+}
@@ -6,7 +6,10 @@
 Grind polishes Go programs.
 
 Usage:
-	grind [-diff] [-v] packagepath...
+	grind [-diff] [-v] [-deadcode=stmts|report|decls] [-since=rev] [-lines=file.go:start-end] [-func=name] packagepath...
+	grind -stats [-format=text|csv|json] packagepath...
+	grind -lsp
+	grind cfg -func=name [-format=dot|json|mermaid] [-annotate=live|reach] [-blocks] file.go...
 
 Grind rewrites the source files in the named packages.
 When grind rewrites a file, it prints a line to standard
@@ -19,6 +22,45 @@ is then rewritten.
 If the -diff flag is set, no files are rewritten.
 Instead grind prints the differences a rewrite would introduce.
 
+If the -v flag is set, grind logs each rewrite it makes.
+
+If the -since flag is set, grind only rewrites the function declarations
+that overlap lines changed since the given git revision, leaving the rest
+of the code alone. If no packages are named, grind rewrites the packages
+containing the changed files. As a special case, -since=- reads a unified
+diff from standard input instead of running git diff, taking its file names
+relative to the current directory.
+
+The -lines and -func flags also restrict grind to particular function
+declarations. The flag -lines=file.go:120-300 selects the functions
+overlapping lines 120 through 300 of file.go, and -func=Name selects
+the functions and methods named Name; -func=T.Name selects only the
+method Name of type T. Both flags may be repeated, and when both are
+given a function must satisfy both to be rewritten.
+
+If the -stats flag is set, no files are rewritten.
+Instead grind reports, for each package and in total, the number of
+goto statements and how many of them it would inline, the number of
+unreachable statements, movable var declarations, and unused labels,
+and the number of lines a rewrite would remove. The -format flag selects
+the report format: text (the default), csv, or json.
+
+If the -lsp flag is set, grind runs as a language server,
+speaking the Language Server Protocol on standard input and output.
+For each open file, it reports the rewrites that apply as diagnostics
+and offers code actions to apply them, along with a command,
+grind.file, that grinds the whole file.
+
+The cfg subcommand writes the control flow graph of the function named
+by -func, which must be declared in the listed files, for inspection.
+The -format flag selects Graphviz dot (the default), JSON, or Mermaid output.
+Each edge is labeled with how control passes along it, such as true, false,
+break, or return. With -annotate=live, each edge is labeled instead with
+the variables live along it; with -annotate=reach, with the definitions
+of each variable reaching it, by line number. JSON output records both.
+With -blocks, cfg writes the function's tree of lexical blocks instead,
+as JSON, Mermaid, or text.
+
 Grind does not make backup copies of the files that it edits.
 Instead, use a version control system's ``diff'' functionality to inspect
 the changes that grind makes before committing them.
@@ -30,10 +72,115 @@ like C code.
 Dead Code Elimination
 
 Grind removes unreachable (dead) code. Code is considered
-unreachable if it is not the target of a goto statement and is
-preceded by a terminating statement
-(see golang.org/ref/spec#Terminating_statements),
-or a break or continue statement.
+unreachable if no path through the function's control flow leads to it:
+if it follows a terminating statement
+(see golang.org/ref/spec#Terminating_statements)
+and is not the target of a live goto statement, or follows a loop
+that never exits, or is guarded by a constant condition,
+as in if false { ... }.
+
+Grind keeps unreachable code when deleting it would leave the program
+unable to compile, as when the code holds the only use of a variable
+or imported package.
+
+The -deadcode flag extends dead code elimination to package-level
+declarations. With -deadcode=report, grind rewrites nothing and instead
+lists the unexported functions, types, constants, and variables that
+nothing in the package refers to, counting a declaration referred to
+only by unused declarations as unused too. With -deadcode=decls, grind
+also deletes those declarations, along with imports only they used.
+It keeps declarations named in the package's test files, variables
+whose initializers might have side effects, and constants whose
+deletion would change the value of iota for the constants after them.
+The default, -deadcode=stmts, removes only unreachable statements.
+
+Constant Condition Folding
+
+Grind simplifies statements whose conditions are compile-time constants,
+such as if 0 != 0 { ... } or for 1 != 0 { ... }. It replaces an if statement
+with the branch that runs, hoisting that branch's statements into the
+enclosing block when their declarations do not conflict with names used there,
+and it drops the condition from a loop that always continues.
+The init statement of a folded if or of a loop that never runs is kept,
+preserving its side effects.
+
+Dead Store Elimination
+
+Grind removes assignments whose values are never read along any path
+through the function, as determined by liveness analysis.
+It also removes local variables that are only ever assigned,
+along with any _ = x statements that read them.
+When the assigned value comes from a function call or channel receive,
+grind keeps the call or receive as a statement of its own.
+Variables whose addresses are taken or that are shared with closures
+are left alone.
+
+Goto Loop Recovery
+
+Grind rewrites a labeled sequence of statements ending in a backward
+goto to the label into a for loop. For example:
+
+	loop:
+		sum += i
+		i++
+		if i < n {
+			goto loop
+		}
+
+becomes:
+
+	for {
+		sum += i
+		i++
+		if i >= n {
+			break
+		}
+	}
+
+Similarly, a labeled if statement whose body ends in a goto back to
+the label becomes a for loop with that condition, and a sequence ending
+in an unconditional goto becomes an infinite loop. Grind rewrites only
+code that the flow graph shows has a single entry, at the label, and
+that contains no break or continue statements the new loop would capture.
+
+Goto Break and Continue
+
+Grind replaces a goto that jumps from inside a loop to the statement
+just after it with a break statement, and a goto that jumps to an empty
+labeled statement ending the loop body with a continue statement.
+A goto back to the label of a for loop with no init or post statement
+becomes a continue statement too. When a bare break or continue would
+refer to an inner loop, switch, or select, grind names the loop's
+label, adding one if needed. For example:
+
+		for _, v := range x {
+			switch {
+			case v < 0:
+				goto out
+			case v == 0:
+				goto next
+			}
+			n += v
+		next:
+		}
+	out:
+		return n
+
+becomes:
+
+	loop:
+		for _, v := range x {
+			switch {
+			case v < 0:
+				break loop
+			case v == 0:
+				continue
+			}
+			n += v
+		}
+		return n
+
+Grind deletes the old target labels once no statements refer to them.
 
 Goto Inlining
 
@@ -44,6 +191,31 @@ a copy of the target code and deletes the original target code.
 If the target of a goto is an explicit or implicit return statement,
 replaces the goto with a copy of the return statement.
 
+Goto If Restructuring
+
+Grind rewrites a conditional goto that skips forward over statements
+to a label later in the same block into an if statement. For example:
+
+		if x < 0 {
+			goto done
+		}
+		x *= 2
+	done:
+		return x
+
+becomes:
+
+		if x >= 0 {
+			x *= 2
+		}
+		return x
+
+When the skipped statements end in a goto past a second label,
+as in if c { goto L }; A; goto M; L: B; M:, grind writes
+if c { B } else { A } instead. Grind rewrites only statements
+that no other goto enters and whose declarations are not used
+after them, and it deletes the labels left unused.
+
 Unused Label Removal
 
 Grind removes unused labels.
@@ -85,13 +257,16 @@ For example, consider:
 Grind deletes the declaration and rewrites both loop initializers
 to use a combined declaration and assignment (i := 0).
 
-Limitation: Grind does not move variable declarations into loop bodies.
-It may in the future, provided it can determine that the variable
-is dead on entry to the body and that the variable does not
-escape (causing heap allocation inside the loop).
+Grind moves a variable declaration into a loop body only when liveness
+analysis shows that the variable is dead on entry to the body, so that
+each iteration can have its own variable. It never moves into a loop a
+variable whose address is taken or that a closure shares, since each
+iteration might then allocate a new one.
 
-Limitation: Grind considers variables that appear in closures off limits.
-A more sophisticated analysis might consider them in the future.
+A variable that appears in a closure is treated as though its address
+were taken where the closure appears: its uses after that point are never
+split from one another, since the closure may read or write it at any time.
+Grind does not move declarations inside closures.
 
 */
 package main
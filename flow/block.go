@@ -0,0 +1,186 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package flow
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+)
+
+// A Block is a basic block: a sequence of graph nodes
+// that is entered only at its first node and left only after its last.
+type Block struct {
+	ID    int        // index in BlockGraph.Blocks
+	Nodes []ast.Node // nodes in execution order
+	Preds []*Block
+	Succs []*Block
+}
+
+// A BlockGraph is the basic-block view of a Graph.
+// Only nodes reachable from the graph's Start are included.
+type BlockGraph struct {
+	Graph  *Graph
+	Blocks []*Block // in depth-first order from Entry
+	Entry  *Block   // block holding Graph.Start; always Blocks[0]
+	Exit   *Block   // block holding Graph.End; nil if End is unreachable
+	Of     map[ast.Node]*Block
+}
+
+// Blocks groups the nodes of g into basic blocks.
+// Block IDs are assigned in depth-first order following Follow,
+// so they are stable for a given graph.
+// Start and End are always alone in their blocks.
+func (g *Graph) Blocks() *BlockGraph {
+	bg := &BlockGraph{
+		Graph: g,
+		Of:    make(map[ast.Node]*Block),
+	}
+	if g == nil || g.Start == nil {
+		return bg
+	}
+
+	// Count predecessors of reachable nodes.
+	npred := make(map[ast.Node]int)
+	seen := map[ast.Node]bool{g.Start: true}
+	stack := []ast.Node{g.Start}
+	for len(stack) > 0 {
+		x := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, y := range g.Follow[x] {
+			npred[y]++
+			if !seen[y] {
+				seen[y] = true
+				stack = append(stack, y)
+			}
+		}
+	}
+
+	leader := func(x ast.Node) bool {
+		return x == g.Start || x == g.End || npred[x] != 1
+	}
+
+	// Form blocks in depth-first order.
+	// The search is iterative; machine-generated
+	// functions can be too large for recursion.
+	newBlock := func(x ast.Node) *Block {
+		b := &Block{ID: len(bg.Blocks)}
+		bg.Blocks = append(bg.Blocks, b)
+		for {
+			b.Nodes = append(b.Nodes, x)
+			bg.Of[x] = b
+			succ := g.Follow[x]
+			if x == g.Start || len(succ) != 1 || leader(succ[0]) {
+				break
+			}
+			x = succ[0]
+		}
+		return b
+	}
+	type frame struct {
+		b *Block
+		i int
+	}
+	bg.Entry = newBlock(g.Start)
+	frames := []frame{{bg.Entry, 0}}
+	for len(frames) > 0 {
+		f := &frames[len(frames)-1]
+		succ := g.Follow[f.b.Last()]
+		if f.i == len(succ) {
+			frames = frames[:len(frames)-1]
+			continue
+		}
+		y := succ[f.i]
+		f.i++
+		if c := bg.Of[y]; c != nil {
+			f.b.Succs = append(f.b.Succs, c)
+			continue
+		}
+		c := newBlock(y)
+		f.b.Succs = append(f.b.Succs, c)
+		frames = append(frames, frame{c, 0})
+	}
+	bg.Exit = bg.Of[g.End]
+	for _, b := range bg.Blocks {
+		for _, c := range b.Succs {
+			c.Preds = append(c.Preds, b)
+		}
+	}
+	return bg
+}
+
+// First returns the first node in b.
+func (b *Block) First() ast.Node {
+	return b.Nodes[0]
+}
+
+// Last returns the last node in b.
+func (b *Block) Last() ast.Node {
+	return b.Nodes[len(b.Nodes)-1]
+}
+
+// Pos returns the smallest valid position of the nodes in b,
+// or token.NoPos if b holds only the synthetic Start or End node.
+func (b *Block) Pos() token.Pos {
+	pos := token.NoPos
+	for _, x := range b.Nodes {
+		if p := x.Pos(); p.IsValid() && (!pos.IsValid() || p < pos) {
+			pos = p
+		}
+	}
+	return pos
+}
+
+// End returns the largest end position of the nodes in b,
+// or token.NoPos if b holds only the synthetic Start or End node.
+func (b *Block) End() token.Pos {
+	end := token.NoPos
+	for _, x := range b.Nodes {
+		if x.Pos().IsValid() && x.End() > end {
+			end = x.End()
+		}
+	}
+	return end
+}
+
+// Position returns the source positions spanned by b.
+func (bg *BlockGraph) Position(b *Block) (start, end token.Position) {
+	fset := bg.Graph.FileSet
+	if pos := b.Pos(); pos.IsValid() {
+		start = fset.Position(pos)
+		end = fset.Position(b.End())
+	}
+	return
+}
+
+// Dump returns a textual listing of the blocks in bg.
+func (bg *BlockGraph) Dump() []byte {
+	var buf bytes.Buffer
+	for _, b := range bg.Blocks {
+		fmt.Fprintf(&buf, "b%d", b.ID)
+		if start, end := bg.Position(b); start.IsValid() {
+			fmt.Fprintf(&buf, " %d-%d", start.Line, end.Line)
+		}
+		fmt.Fprintf(&buf, ":")
+		printBlocks(&buf, " preds:", b.Preds)
+		printBlocks(&buf, " succs:", b.Succs)
+		fmt.Fprintf(&buf, "\n")
+		for _, x := range b.Nodes {
+			fmt.Fprintf(&buf, "\t%s\n", nodeLabel(bg.Graph.FileSet, x))
+		}
+	}
+	return buf.Bytes()
+}
+
+func printBlocks(buf *bytes.Buffer, prefix string, list []*Block) {
+	if len(list) == 0 {
+		return
+	}
+	buf.WriteString(prefix)
+	for _, b := range list {
+		fmt.Fprintf(buf, " b%d", b.ID)
+	}
+}
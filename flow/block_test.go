@@ -0,0 +1,104 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package flow
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBlocksGolden(t *testing.T) {
+	matches, err := filepath.Glob("testdata/cfg-*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) == 0 {
+		t.Fatal("no testdata found")
+	}
+	fset := token.NewFileSet()
+	for _, file := range matches {
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		fn, ok := f.Decls[len(f.Decls)-1].(*ast.FuncDecl)
+		if !ok {
+			t.Errorf("%s: found %T, want *ast.FuncDecl", file, f.Decls[0])
+			continue
+		}
+
+		g := Build(fset, fn.Body, isIdentOrAssign)
+		bg := g.Blocks()
+		checkBlocks(t, file, g, bg)
+		dump := bg.Dump()
+		base := strings.TrimSuffix(file, ".go")
+		golden, _ := ioutil.ReadFile(base + ".blocks")
+		if bytes.Equal(dump, golden) {
+			continue
+		}
+		ioutil.WriteFile(base+".blocks.xxx", dump, 0666)
+		t.Errorf("%s: wrong blocks; have %s.blocks.xxx, want %s.blocks", file, base, base)
+	}
+}
+
+// checkBlocks checks that the block edges agree with g.Follow.
+func checkBlocks(t *testing.T, file string, g *Graph, bg *BlockGraph) {
+	if bg.Entry != bg.Blocks[0] || bg.Entry.First() != g.Start {
+		t.Errorf("%s: Entry does not start at Start", file)
+	}
+	for i, b := range bg.Blocks {
+		if b.ID != i {
+			t.Errorf("%s: Blocks[%d].ID = %d", file, i, b.ID)
+		}
+		for j, x := range b.Nodes {
+			if bg.Of[x] != b {
+				t.Errorf("%s: b%d: Of[%s] = wrong block", file, b.ID, nodeLabel(g.FileSet, x))
+			}
+			if j+1 < len(b.Nodes) && (len(g.Follow[x]) != 1 || g.Follow[x][0] != b.Nodes[j+1]) {
+				t.Errorf("%s: b%d: node %d does not flow only to node %d", file, b.ID, j, j+1)
+			}
+		}
+		var succs []*Block
+		for _, y := range g.Follow[b.Last()] {
+			succs = append(succs, bg.Of[y])
+		}
+		if !sameBlocks(succs, b.Succs) {
+			t.Errorf("%s: b%d: Succs do not match Follow of last node", file, b.ID)
+		}
+		for _, c := range b.Succs {
+			if !containsBlock(c.Preds, b) {
+				t.Errorf("%s: b%d: missing from Preds of successor b%d", file, b.ID, c.ID)
+			}
+		}
+	}
+}
+
+func sameBlocks(x, y []*Block) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func containsBlock(list []*Block, b *Block) bool {
+	for _, c := range list {
+		if c == b {
+			return true
+		}
+	}
+	return false
+}
@@ -35,6 +35,7 @@ package flow
 
 import (
 	"bytes"
+	"container/heap"
 	"fmt"
 	"go/ast"
 	"go/token"
@@ -46,6 +47,16 @@ type Graph struct {
 	Start   ast.Node
 	End     ast.Node
 	Follow  map[ast.Node][]ast.Node
+	Kinds   map[ast.Node][]EdgeKind // Kinds[x][i] is the kind of the edge from x to Follow[x][i]
+	Preds   map[ast.Node][]ast.Node // inverse of Follow, for nodes reachable from Start
+
+	// A function literal appears in the graph of its enclosing function
+	// as a single *ast.FuncLit node, the point where the closure is created
+	// and captures its variables. Its body has a graph of its own.
+	Lit    *ast.FuncLit                // literal whose body g describes; nil for the outermost graph
+	Parent *Graph                      // graph of the enclosing function; nil for the outermost graph
+	Funcs  map[*ast.FuncLit]*Graph     // graphs of the literals directly inside the body
+	Calls  map[*ast.FuncLit][]ast.Node // calls that run each literal in this function; see Build
 }
 
 type Computation interface {
@@ -54,18 +65,79 @@ type Computation interface {
 	Join(ast.Node, ast.Node) bool
 }
 
+// A Config controls how Build models calls that do not return
+// and conditions that do not vary.
+type Config struct {
+	// Terminates reports how a call ends the function, if it does.
+	// If Terminates is nil, Build uses DefaultTerminates.
+	Terminates func(call *ast.CallExpr) Termination
+
+	// Constant reports whether the condition cond always has the same value,
+	// and if so, what it is. Build follows only the branch such a condition
+	// selects. If Constant is nil, Build treats every condition as unknown,
+	// since deleting code guarded by a constant may leave a program that no
+	// longer compiles, for example because a variable is no longer used.
+	Constant func(cond ast.Expr) (value, ok bool)
+}
+
+// A Termination describes how a call affects the flow of control.
+type Termination int
+
+const (
+	Returns Termination = iota // call may return normally
+	Panics                     // call does not return; deferred calls run, as for panic or runtime.Goexit
+	Exits                      // call ends the program; deferred calls do not run, as for os.Exit
+)
+
+// An EdgeKind describes how control passes along an edge of a Graph.
+// It is a set of bits, because an edge can stand for several paths:
+// an if statement with an empty body leaves its condition for the same
+// node whether the condition is true or false, and when Build removes
+// an uninteresting node, the edges that bypass it combine the kinds of
+// the edges into and out of it. Ordinary sequential flow has kind 0.
+type EdgeKind uint16
+
+const (
+	EdgeTrue        EdgeKind = 1 << iota // condition was true, or a switch case matched, or a range loop iterates
+	EdgeFalse                            // condition was false, or a switch case did not match, or a range loop ends
+	EdgeFallthrough                      // fallthrough statement
+	EdgeBreak                            // break statement
+	EdgeContinue                         // continue statement
+	EdgeGoto                             // goto statement
+	EdgeReturn                           // return statement
+	EdgePanic                            // call that Panics
+	EdgeExit                             // call that Exits
+)
+
+var edgeKindNames = []string{"true", "false", "fallthrough", "break", "continue", "goto", "return", "panic", "exit"}
+
+// String returns the names of the kinds in k, separated by |,
+// as in "true|break". It returns "" for ordinary flow.
+func (k EdgeKind) String() string {
+	var names []string
+	for i, name := range edgeKindNames {
+		if k&(1<<uint(i)) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
 type builder struct {
 	interesting  func(ast.Node) bool
-	followCache  map[ast.Node][]ast.Node
+	terminates   func(*ast.CallExpr) Termination
+	constant     func(ast.Expr) (bool, bool)
+	followCache  map[ast.Node][]edge
 	end          ast.Node
+	exit         []edge
 	need         map[ast.Node]bool
 	trimmed      map[ast.Node]bool
 	followed     map[ast.Node]bool
-	brk          []ast.Node
-	cont         []ast.Node
-	fall         []ast.Node
-	brkLabel     map[string][]ast.Node
-	contLabel    map[string][]ast.Node
+	brk          []edge
+	cont         []edge
+	fall         []edge
+	brkLabel     map[string][]edge
+	contLabel    map[string][]edge
 	gotoLabel    map[string]ast.Node
 	isGotoTarget map[string]bool
 	stmtLabel    map[ast.Stmt]string
@@ -73,54 +145,301 @@ type builder struct {
 
 // Build constructs a control flow graph,
 // filtered to include only interesting nodes.
+// It is equivalent to new(Config).Build(fset, body, interesting).
 func Build(fset *token.FileSet, body *ast.BlockStmt, interesting func(ast.Node) bool) *Graph {
+	return new(Config).Build(fset, body, interesting)
+}
+
+// Build constructs a control flow graph,
+// filtered to include only interesting nodes.
+//
+// Every way of leaving the function other than a call that Exits,
+// including returning, falling off the end of body, and panicking,
+// passes through the deferred calls on its way to End.
+// Each deferred call is represented by the *ast.CallExpr of its
+// *ast.DeferStmt, which itself marks the point where the call's
+// function and arguments are evaluated. Since a defer statement
+// may not have executed on a given path, each deferred call may be
+// skipped, but they only run in the reverse of source order.
+// A panic reaches End after the deferred calls, since one of them may recover.
+//
+// Build also constructs graphs for the bodies of the function literals
+// in body, recorded in Funcs. When a literal is called directly, as in
+// func() { ... }() or defer func() { ... }(), the *ast.CallExpr is
+// recorded in Calls as the point where the literal's body runs.
+// Similarly, when a range statement iterates over a function literal,
+// the *ast.RangeStmt is recorded as the literal's call.
+// A literal called by a go statement runs in a new goroutine,
+// and a literal stored for later use may run at any time, so neither
+// has a call recorded. Like other nodes, the literals and calls
+// appear in the graph only if interesting reports true for them.
+func (cfg *Config) Build(fset *token.FileSet, body *ast.BlockStmt, interesting func(ast.Node) bool) *Graph {
 	start := &ast.Ident{Name: "_cfg_start_"}
 	end := &ast.Ident{Name: "_cfg_end_"}
 	b := &builder{
 		interesting:  interesting,
-		followCache:  make(map[ast.Node][]ast.Node),
+		terminates:   cfg.Terminates,
+		constant:     cfg.Constant,
+		followCache:  make(map[ast.Node][]edge),
 		end:          end,
 		need:         make(map[ast.Node]bool),
 		trimmed:      make(map[ast.Node]bool),
 		followed:     make(map[ast.Node]bool),
-		brkLabel:     make(map[string][]ast.Node),
-		contLabel:    make(map[string][]ast.Node),
+		brkLabel:     make(map[string][]edge),
+		contLabel:    make(map[string][]edge),
 		gotoLabel:    make(map[string]ast.Node),
 		isGotoTarget: make(map[string]bool),
 		stmtLabel:    make(map[ast.Stmt]string),
 	}
 
+	if b.terminates == nil {
+		b.terminates = DefaultTerminates
+	}
+
 	ast.Inspect(body, b.scanGoto)
-	b.followCache[start] = b.trimList(b.follow(body, []ast.Node{end}))
-	return &Graph{
+	b.exit = []edge{{end, 0}}
+	for _, d := range deferStmts(body) {
+		b.exit = merge(b.addNode(d.Call, b.exit), b.exit)
+	}
+	b.followCache[start] = b.trimList(b.follow(body, b.exit))
+	g := &Graph{
 		FileSet: fset,
 		Start:   start,
 		End:     end,
-		Follow:  b.followCache,
+		Follow:  make(map[ast.Node][]ast.Node),
+		Kinds:   make(map[ast.Node][]EdgeKind),
+		Funcs:   make(map[*ast.FuncLit]*Graph),
+		Calls:   make(map[*ast.FuncLit][]ast.Node),
+	}
+	for x, list := range b.followCache {
+		for _, e := range list {
+			g.Follow[x] = append(g.Follow[x], e.to)
+			g.Kinds[x] = append(g.Kinds[x], e.kind)
+		}
+	}
+	g.Preds = g.preds()
+
+	cfg.buildFuncs(g, body, interesting)
+	return g
+}
+
+// buildFuncs builds the graphs for the function literals in x
+// and records the calls that run them.
+func (cfg *Config) buildFuncs(g *Graph, x ast.Node, interesting func(ast.Node) bool) {
+	ast.Inspect(x, func(x ast.Node) bool {
+		switch x := x.(type) {
+		case *ast.FuncLit:
+			sub := cfg.Build(g.FileSet, x.Body, interesting)
+			sub.Lit = x
+			sub.Parent = g
+			g.Funcs[x] = sub
+			return false
+		case *ast.GoStmt:
+			// The call itself runs in the new goroutine.
+			cfg.buildFuncs(g, x.Call.Fun, interesting)
+			for _, arg := range x.Call.Args {
+				cfg.buildFuncs(g, arg, interesting)
+			}
+			return false
+		case *ast.CallExpr:
+			if lit, ok := unparen(x.Fun).(*ast.FuncLit); ok {
+				g.Calls[lit] = append(g.Calls[lit], x)
+			}
+		case *ast.RangeStmt:
+			if lit, ok := unparen(x.X).(*ast.FuncLit); ok {
+				g.Calls[lit] = append(g.Calls[lit], x)
+			}
+		}
+		return true
+	})
+}
+
+// Kind returns the kind of the edge from x to y, or 0 if there is none.
+func (g *Graph) Kind(x, y ast.Node) EdgeKind {
+	for i, z := range g.Follow[x] {
+		if z == y {
+			return g.Kinds[x][i]
+		}
+	}
+	return 0
+}
+
+func (g *Graph) kindLabel(src, dst ast.Node) string {
+	return g.Kind(src, dst).String()
+}
+
+// preds returns the predecessor lists for the nodes reachable from g.Start.
+// Each list is in the order the predecessors are first reached.
+func (g *Graph) preds() map[ast.Node][]ast.Node {
+	preds := make(map[ast.Node][]ast.Node)
+	seen := map[ast.Node]bool{g.Start: true}
+	queue := []ast.Node{g.Start}
+	for len(queue) > 0 {
+		x := queue[0]
+		queue = queue[1:]
+		for _, y := range g.Follow[x] {
+			preds[y] = append(preds[y], x)
+			if !seen[y] {
+				seen[y] = true
+				queue = append(queue, y)
+			}
+		}
+	}
+	return preds
+}
+
+// deferStmts returns the defer statements in body, in source order,
+// not counting those in function literals.
+func deferStmts(body *ast.BlockStmt) []*ast.DeferStmt {
+	var list []*ast.DeferStmt
+	ast.Inspect(body, func(x ast.Node) bool {
+		switch x := x.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.DeferStmt:
+			list = append(list, x)
+		}
+		return true
+	})
+	return list
+}
+
+// DefaultTerminates recognizes the standard calls that do not return:
+// panic, log.Panic, log.Panicf, log.Panicln, runtime.Goexit, and
+// the FailNow, Fatal, Fatalf, SkipNow, Skip, and Skipf methods of
+// testing.T, testing.B, testing.F, and testing.TB variables all Panic;
+// os.Exit, syscall.Exit, log.Fatal, log.Fatalf, and log.Fatalln Exit.
+// It works from the syntax alone, so it only recognizes package names
+// and panic that the parser left unresolved, and only recognizes testing
+// variables declared as function parameters.
+func DefaultTerminates(call *ast.CallExpr) Termination {
+	switch fn := unparen(call.Fun).(type) {
+	case *ast.Ident:
+		if fn.Name == "panic" && fn.Obj == nil {
+			return Panics
+		}
+	case *ast.SelectorExpr:
+		x, ok := fn.X.(*ast.Ident)
+		if !ok {
+			break
+		}
+		if x.Obj == nil {
+			switch x.Name + "." + fn.Sel.Name {
+			case "log.Panic", "log.Panicf", "log.Panicln", "runtime.Goexit":
+				return Panics
+			case "os.Exit", "syscall.Exit", "log.Fatal", "log.Fatalf", "log.Fatalln":
+				return Exits
+			}
+			break
+		}
+		switch fn.Sel.Name {
+		case "FailNow", "Fatal", "Fatalf", "SkipNow", "Skip", "Skipf":
+			if isTestingVar(x) {
+				return Panics
+			}
+		}
+	}
+	return Returns
+}
+
+// isTestingVar reports whether x refers to a parameter
+// of type *testing.T, *testing.B, *testing.F, or testing.TB.
+func isTestingVar(x *ast.Ident) bool {
+	if x.Obj == nil || x.Obj.Kind != ast.Var {
+		return false
 	}
+	field, ok := x.Obj.Decl.(*ast.Field)
+	if !ok {
+		return false
+	}
+	typ := field.Type
+	star, isPtr := typ.(*ast.StarExpr)
+	if isPtr {
+		typ = star.X
+	}
+	sel, ok := typ.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	if pkg, ok := sel.X.(*ast.Ident); !ok || pkg.Name != "testing" {
+		return false
+	}
+	switch sel.Sel.Name {
+	case "T", "B", "F":
+		return isPtr
+	case "TB":
+		return !isPtr
+	}
+	return false
 }
 
-func (b *builder) trimList(list []ast.Node) []ast.Node {
+// trimList returns list with the nodes that are not needed replaced
+// by their successors. The kind of an edge that bypasses a node
+// combines the kinds of the edges into and out of it.
+func (b *builder) trimList(list []edge) []edge {
 	if len(list) == 0 {
 		return list
 	}
-	return mergef(b.trim(list[0]), b.trimList(list[1:]))
+	return merge(withKind(b.trim(list[0].to), list[0].kind), b.trimList(list[1:]))
 }
 
-func (b *builder) trim(x ast.Node) []ast.Node {
+func (b *builder) trim(x ast.Node) []edge {
 	if x == nil {
 		return nil
 	}
 	if !b.trimmed[x] {
 		b.trimmed[x] = true
 		fol := b.followCache[x]
-		b.followCache[x] = []ast.Node{x} // during recursion
+		b.followCache[x] = []edge{{x, 0}} // during recursion
 		b.followCache[x] = b.trimList(fol)
 	}
 	if !b.need[x] && len(b.followCache[x]) > 0 {
 		return b.followCache[x]
 	}
-	return []ast.Node{x}
+	return []edge{{x, 0}}
+}
+
+// An edge is an entry in a successor list.
+type edge struct {
+	to   ast.Node
+	kind EdgeKind
+}
+
+// merge is like mergef for successor lists.
+// An edge to a node in both lists has the kinds of both.
+func merge(l1, l2 []edge) []edge {
+	if l1 == nil {
+		return l2
+	}
+	if l2 == nil {
+		return l1
+	}
+	out := append([]edge(nil), l1...)
+	index := make(map[ast.Node]int)
+	for i, e := range l1 {
+		index[e.to] = i
+	}
+	for _, e := range l2 {
+		if i, ok := index[e.to]; ok {
+			out[i].kind |= e.kind
+		} else {
+			index[e.to] = len(out)
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// withKind returns a copy of list with kind added to each edge.
+func withKind(list []edge, kind EdgeKind) []edge {
+	if kind == 0 || len(list) == 0 {
+		return list
+	}
+	out := make([]edge, len(list))
+	for i, e := range list {
+		out[i] = edge{e.to, e.kind | kind}
+	}
+	return out
 }
 
 func mergef(l1, l2 []ast.Node) []ast.Node {
@@ -146,6 +465,8 @@ func mergef(l1, l2 []ast.Node) []ast.Node {
 
 func (b *builder) scanGoto(x ast.Node) bool {
 	switch x := x.(type) {
+	case *ast.FuncLit:
+		return false // labels are local to the literal
 	case *ast.LabeledStmt:
 		b.gotoLabel[x.Label.Name] = x
 	case *ast.BranchStmt:
@@ -156,10 +477,7 @@ func (b *builder) scanGoto(x ast.Node) bool {
 	return true // scan children
 }
 
-func (b *builder) followCond(cond ast.Expr, btrue, bfalse []ast.Node) []ast.Node {
-	// Could be more precise by looking at cond to see if it is
-	// a constant true or false, but that might lead to code
-	// rewrites that make dead code no longer compile.
+func (b *builder) followCond(cond ast.Expr, btrue, bfalse []edge) []edge {
 	switch x := cond.(type) {
 	case *ast.BinaryExpr:
 		switch x.Op {
@@ -176,16 +494,25 @@ func (b *builder) followCond(cond ast.Expr, btrue, bfalse []ast.Node) []ast.Node
 	case *ast.ParenExpr:
 		return b.followCond(x.X, btrue, bfalse)
 	}
-	return b.follow(cond, mergef(btrue, bfalse))
+	if b.constant != nil {
+		if v, ok := b.constant(cond); ok {
+			if v {
+				bfalse = nil
+			} else {
+				btrue = nil
+			}
+		}
+	}
+	return b.follow(cond, merge(withKind(btrue, EdgeTrue), withKind(bfalse, EdgeFalse)))
 }
 
-func (b *builder) addNode(x ast.Node, out []ast.Node) []ast.Node {
+func (b *builder) addNode(x ast.Node, out []edge) []edge {
 	b.followCache[x] = out
 	if !b.need[x] && !b.interesting(x) {
 		return out
 	}
 	b.need[x] = true
-	return []ast.Node{x}
+	return []edge{{x, 0}}
 }
 
 func astVisit(x ast.Node, f visitFunc) {
@@ -219,7 +546,7 @@ func astSplit(x ast.Node) []ast.Node {
 	return list
 }
 
-func (b *builder) previsit(x ast.Node, out []ast.Node) []ast.Node {
+func (b *builder) previsit(x ast.Node, out []edge) []edge {
 	list := astSplit(x)
 	for i := len(list) - 1; i >= 0; i-- {
 		out = b.follow(list[i], out)
@@ -228,7 +555,7 @@ func (b *builder) previsit(x ast.Node, out []ast.Node) []ast.Node {
 	return out
 }
 
-func (b *builder) postvisit(x ast.Node, out []ast.Node) []ast.Node {
+func (b *builder) postvisit(x ast.Node, out []edge) []edge {
 	out = b.addNode(x, out)
 	list := astSplit(x)
 	for i := len(list) - 1; i >= 0; i-- {
@@ -237,7 +564,7 @@ func (b *builder) postvisit(x ast.Node, out []ast.Node) []ast.Node {
 	return out
 }
 
-func (b *builder) follow(x ast.Node, out []ast.Node) []ast.Node {
+func (b *builder) follow(x ast.Node, out []edge) []edge {
 	switch x.(type) {
 	case ast.Expr, ast.Stmt:
 		// ok
@@ -261,6 +588,13 @@ func (b *builder) follow(x ast.Node, out []ast.Node) []ast.Node {
 			}
 		case *ast.FuncLit:
 			return b.addNode(x, out)
+		case *ast.CallExpr:
+			switch b.terminates(x) {
+			case Panics:
+				out = withKind(b.exit, EdgePanic)
+			case Exits:
+				out = []edge{{b.end, EdgeExit}}
+			}
 		}
 		return b.postvisit(x, out)
 	}
@@ -290,21 +624,21 @@ func (b *builder) follow(x ast.Node, out []ast.Node) []ast.Node {
 		switch x.Tok {
 		case token.BREAK:
 			if x.Label != nil {
-				return b.brkLabel[x.Label.Name]
+				return b.addNode(x, withKind(b.brkLabel[x.Label.Name], EdgeBreak))
 			}
-			return b.brk
+			return b.addNode(x, withKind(b.brk, EdgeBreak))
 
 		case token.CONTINUE:
 			if x.Label != nil {
-				return b.contLabel[x.Label.Name]
+				return b.addNode(x, withKind(b.contLabel[x.Label.Name], EdgeContinue))
 			}
-			return b.cont
+			return b.addNode(x, withKind(b.cont, EdgeContinue))
 
 		case token.GOTO:
-			return []ast.Node{b.gotoLabel[x.Label.Name]}
+			return b.addNode(x, []edge{{b.gotoLabel[x.Label.Name], EdgeGoto}})
 
 		case token.FALLTHROUGH:
-			return b.fall
+			return b.addNode(x, withKind(b.fall, EdgeFallthrough))
 		}
 
 	case *ast.LabeledStmt:
@@ -319,41 +653,52 @@ func (b *builder) follow(x ast.Node, out []ast.Node) []ast.Node {
 		oldBrk := b.brk
 		b.brk = out
 		oldCont := b.cont
-		b.cont = b.follow(x.Post, []ast.Node{x}) // note: x matches b.addNode below, cleaned up by trim
+		b.cont = b.follow(x.Post, []edge{{x, 0}}) // note: x matches b.addNode below, cleaned up by trim
 		if label := b.stmtLabel[x]; label != "" {
 			b.brkLabel[label] = b.brk
 			b.contLabel[label] = b.cont
 		}
 		bin := b.follow(x.Body, b.cont)
-		var condOut []ast.Node
-		if x.Cond == nil {
-			condOut = bin
-		} else {
-			condOut = mergef(bin, out)
-		}
 		b.brk = oldBrk
 		b.cont = oldCont
-		return b.follow(x.Init, b.addNode(x, b.follow(x.Cond, condOut)))
+		if x.Cond != nil {
+			bin = b.followCond(x.Cond, bin, out)
+		}
+		return b.follow(x.Init, b.addNode(x, bin))
 
 	case *ast.IfStmt:
-		return b.follow(x.Init, b.followCond(x.Cond, b.follow(x.Body, out), b.follow(x.Else, out)))
+		return b.addNode(x, b.follow(x.Init, b.followCond(x.Cond, b.follow(x.Body, out), b.follow(x.Else, out))))
 
 	case *ast.RangeStmt:
+		// The same shape serves for ranging over an integer or a function.
+		// The body of a range-over-func loop is compiled as the yield
+		// function, but break, continue, return, and goto in it behave
+		// as in any other loop, and yield cannot be called after the
+		// iterator returns, so the body runs only while the loop runs.
 		oldBrk := b.brk
 		b.brk = out
 		oldCont := b.cont
-		b.cont = []ast.Node{x} // note: x matches b.addNode below, cleaned up by trim
+		b.cont = []edge{{x, 0}} // note: x matches b.addNode below, cleaned up by trim
 		if label := b.stmtLabel[x]; label != "" {
 			b.brkLabel[label] = b.brk
 			b.contLabel[label] = b.cont
 		}
-		out = b.addNode(x, mergef(b.follow(x.Key, b.follow(x.Value, b.follow(x.Body, b.cont))), out))
+		next := b.follow(x.Key, b.follow(x.Value, b.follow(x.Body, b.cont)))
+		out = b.addNode(x, merge(withKind(next, EdgeTrue), withKind(out, EdgeFalse)))
 		b.brk = oldBrk
 		b.cont = oldCont
 		return b.follow(x.X, out)
 
 	case *ast.ReturnStmt:
-		return b.followExprs(x.Results, []ast.Node{b.end})
+		return b.addNode(x, b.followExprs(x.Results, withKind(b.exit, EdgeReturn)))
+
+	case *ast.DeferStmt:
+		// The call itself runs on the way out of the function; see Build.
+		return b.addNode(x, b.follow(x.Call.Fun, b.followExprs(x.Call.Args, out)))
+
+	case *ast.GoStmt:
+		// The call runs in the new goroutine, not here.
+		return b.addNode(x, b.follow(x.Call.Fun, b.followExprs(x.Call.Args, out)))
 
 	case *ast.SelectStmt:
 		oldBrk := b.brk
@@ -361,7 +706,7 @@ func (b *builder) follow(x ast.Node, out []ast.Node) []ast.Node {
 		if label := b.stmtLabel[x]; label != "" {
 			b.brkLabel[label] = b.brk
 		}
-		var allCasOut []ast.Node
+		var allCasOut []edge
 		for _, xcas := range x.Body.List {
 			cas := xcas.(*ast.CommClause)
 			casOut := b.followStmts(cas.Body, out)
@@ -371,7 +716,7 @@ func (b *builder) follow(x ast.Node, out []ast.Node) []ast.Node {
 					casOut = b.follow(comm.Lhs[i], casOut)
 				}
 			}
-			allCasOut = mergef(allCasOut, casOut)
+			allCasOut = merge(allCasOut, casOut)
 		}
 		out = allCasOut
 		for i := len(x.Body.List) - 1; i >= 0; i-- {
@@ -388,7 +733,7 @@ func (b *builder) follow(x ast.Node, out []ast.Node) []ast.Node {
 			}
 		}
 		b.brk = oldBrk
-		return out
+		return b.addNode(x, out)
 
 	case *ast.SwitchStmt:
 		oldBrk := b.brk
@@ -410,7 +755,7 @@ func (b *builder) follow(x ast.Node, out []ast.Node) []ast.Node {
 				if len(cas.Body) > 0 && isFallthrough(cas.Body[len(cas.Body)-1]) {
 					if i+1 < len(x.Body.List) {
 						needFall = x.Body.List[i+1].(*ast.CaseClause)
-						b.fall = []ast.Node{needFall}
+						b.fall = []edge{{needFall, 0}}
 					}
 				}
 				nextCase = b.followStmts(cas.Body, out)
@@ -429,13 +774,13 @@ func (b *builder) follow(x ast.Node, out []ast.Node) []ast.Node {
 			}
 			b.fall = casOut
 			for j := len(cas.List) - 1; j >= 0; j-- {
-				nextCase = b.follow(cas.List[j], mergef(nextCase, casOut))
+				nextCase = b.follow(cas.List[j], merge(withKind(nextCase, EdgeFalse), withKind(casOut, EdgeTrue)))
 			}
 		}
 
 		b.brk = oldBrk
 		b.fall = oldFall
-		return b.follow(x.Init, b.follow(x.Tag, nextCase))
+		return b.addNode(x, b.follow(x.Init, b.follow(x.Tag, nextCase)))
 
 	case *ast.TypeSwitchStmt:
 		// Easier than switch: no fallthrough, case values are not executable.
@@ -445,63 +790,186 @@ func (b *builder) follow(x ast.Node, out []ast.Node) []ast.Node {
 			b.brkLabel[label] = b.brk
 		}
 
-		var allCasOut []ast.Node
+		var allCasOut []edge
 		defaultOut := out
 		for i := len(x.Body.List) - 1; i >= 0; i-- {
 			cas := x.Body.List[i].(*ast.CaseClause)
 			if cas.List == nil {
 				defaultOut = nil
 			}
-			allCasOut = mergef(allCasOut, b.followStmts(cas.Body, out))
+			allCasOut = merge(allCasOut, b.followStmts(cas.Body, out))
 		}
 		b.brk = oldBrk
-		return b.follow(x.Init, b.follow(x.Assign, mergef(allCasOut, defaultOut)))
+		return b.addNode(x, b.follow(x.Init, b.follow(x.Assign, merge(allCasOut, defaultOut))))
 	}
 
 	return b.previsit(x, out)
 }
 
-func (b *builder) followExprs(x []ast.Expr, out []ast.Node) []ast.Node {
+func (b *builder) followExprs(x []ast.Expr, out []edge) []edge {
 	for i := len(x) - 1; i >= 0; i-- {
 		out = b.follow(x[i], out)
 	}
 	return out
 }
 
-func (b *builder) followStmts(x []ast.Stmt, out []ast.Node) []ast.Node {
+func (b *builder) followStmts(x []ast.Stmt, out []edge) []edge {
 	for i := len(x) - 1; i >= 0; i-- {
 		out = b.follow(x[i], out)
 	}
 	return out
 }
 
+func unparen(x ast.Expr) ast.Expr {
+	for {
+		p, ok := x.(*ast.ParenExpr)
+		if !ok {
+			return x
+		}
+		x = p.X
+	}
+}
+
 func isFallthrough(x ast.Stmt) bool {
 	br, ok := x.(*ast.BranchStmt)
 	return ok && br.Tok == token.FALLTHROUGH
 }
 
+// Dataflow runs compute forward over g, starting at Start,
+// until it reaches a fixed point.
+// Init is called for Start, and Join(y, x) merges the state
+// computed by Transfer(x) into its successor y, reporting whether
+// y's state changed.
 func (g *Graph) Dataflow(compute Computation) {
-	if g == nil || g.Start == nil {
-		return
+	g.Solve(compute, DataflowOptions{})
+}
+
+// DataflowBackward is like Dataflow but runs against the flow of control,
+// starting at End and following Preds. Compute's Init is called for End,
+// and Join(y, x) merges the state computed by Transfer(x) into
+// its predecessor y.
+func (g *Graph) DataflowBackward(compute Computation) {
+	g.Solve(compute, DataflowOptions{Backward: true})
+}
+
+// DataflowOptions control Solve.
+type DataflowOptions struct {
+	Backward  bool // run against the flow of control, as in DataflowBackward
+	MaxVisits int  // maximum number of Transfer calls for any one node; 0 means no limit
+}
+
+// DataflowStats records the work done by Solve.
+type DataflowStats struct {
+	Nodes     int // nodes visited
+	Transfers int // calls to Transfer
+	Joins     int // calls to Join
+	Changes   int // calls to Join reporting a change
+	MaxVisits int // largest number of Transfer calls for any one node
+}
+
+// Solve runs compute over g until it reaches a fixed point,
+// as described for Dataflow and DataflowBackward.
+// Pending nodes are visited in reverse postorder, so that
+// in the absence of loops each node is transferred only once,
+// after all the nodes flowing into it.
+// If opts.MaxVisits is positive and some node would be transferred
+// more than that many times, Solve stops and returns an error,
+// leaving compute's state partially updated.
+func (g *Graph) Solve(compute Computation, opts DataflowOptions) (DataflowStats, error) {
+	var stats DataflowStats
+	if g == nil {
+		return stats, nil
+	}
+	root, succ := g.Start, g.Follow
+	if opts.Backward {
+		root, succ = g.End, g.Preds
+	}
+	if root == nil {
+		return stats, nil
 	}
 
-	visited := make(map[ast.Node]bool)
-	compute.Init(g.Start)
-	var workq, nextq []ast.Node
-	workq = append(workq, g.Start)
-	visited[g.Start] = true
-	for len(workq) > 0 {
-		for _, x := range workq {
-			compute.Transfer(x)
-			for _, y := range g.Follow[x] {
-				if compute.Join(y, x) || !visited[y] {
-					visited[y] = true
-					nextq = append(nextq, y)
-				}
+	q := &workq{index: reversePostorder(root, succ)}
+	visits := make(map[ast.Node]int)
+	queued := map[ast.Node]bool{root: true}
+	compute.Init(root)
+	heap.Push(q, root)
+	for q.Len() > 0 {
+		x := heap.Pop(q).(ast.Node)
+		queued[x] = false
+		visits[x]++
+		if n := visits[x]; n > stats.MaxVisits {
+			stats.MaxVisits = n
+			if opts.MaxVisits > 0 && n > opts.MaxVisits {
+				stats.Nodes = len(visits)
+				return stats, fmt.Errorf("flow: dataflow did not converge: %s transferred %d times", nodeLabel(g.FileSet, x), n)
+			}
+		}
+		stats.Transfers++
+		compute.Transfer(x)
+		for _, y := range succ[x] {
+			stats.Joins++
+			changed := compute.Join(y, x)
+			if changed {
+				stats.Changes++
+			}
+			if (changed || visits[y] == 0) && !queued[y] {
+				queued[y] = true
+				heap.Push(q, y)
 			}
 		}
-		workq, nextq = nextq, workq[:0]
 	}
+	stats.Nodes = len(visits)
+	return stats, nil
+}
+
+// reversePostorder returns the reverse postorder numbering
+// of the nodes reachable from root.
+func reversePostorder(root ast.Node, succ map[ast.Node][]ast.Node) map[ast.Node]int {
+	// Iterative depth-first search; machine-generated
+	// functions can be too large for recursion.
+	type frame struct {
+		x ast.Node
+		i int
+	}
+	var post []ast.Node
+	seen := map[ast.Node]bool{root: true}
+	stack := []frame{{root, 0}}
+	for len(stack) > 0 {
+		f := &stack[len(stack)-1]
+		if f.i < len(succ[f.x]) {
+			y := succ[f.x][f.i]
+			f.i++
+			if !seen[y] {
+				seen[y] = true
+				stack = append(stack, frame{y, 0})
+			}
+			continue
+		}
+		post = append(post, f.x)
+		stack = stack[:len(stack)-1]
+	}
+	index := make(map[ast.Node]int, len(post))
+	for i, x := range post {
+		index[x] = len(post) - 1 - i
+	}
+	return index
+}
+
+// A workq is a priority queue of nodes ordered by index.
+type workq struct {
+	index map[ast.Node]int
+	list  []ast.Node
+}
+
+func (q *workq) Len() int           { return len(q.list) }
+func (q *workq) Less(i, j int) bool { return q.index[q.list[i]] < q.index[q.list[j]] }
+func (q *workq) Swap(i, j int)      { q.list[i], q.list[j] = q.list[j], q.list[i] }
+func (q *workq) Push(x interface{}) { q.list = append(q.list, x.(ast.Node)) }
+
+func (q *workq) Pop() interface{} {
+	x := q.list[len(q.list)-1]
+	q.list = q.list[:len(q.list)-1]
+	return x
 }
 
 type printer struct {
@@ -561,9 +1029,13 @@ func (p *printer) print(x ast.Node) {
 	}
 }
 
+// Dot returns a Graphviz description of g.
+// If edge is not nil, it is called to label each edge;
+// a label beginning with ! marks the edge in red.
+// If edge is nil, each edge is labeled with its kind.
 func (g *Graph) Dot(edge func(src, dst ast.Node) string) []byte {
 	if edge == nil {
-		edge = func(src, dst ast.Node) string { return "" }
+		edge = g.kindLabel
 	}
 	p := &printer{
 		visited: make(map[ast.Node]bool),
@@ -12,6 +12,7 @@ import (
 	"go/token"
 	"io/ioutil"
 	"path/filepath"
+	"sort"
 	"strings"
 	"testing"
 )
@@ -41,7 +42,14 @@ func TestBuildGolden(t *testing.T) {
 			continue
 		}
 
-		g := Build(fset, fn.Body, isIdentOrAssign)
+		// Show deferred calls, which run on the way to End.
+		deferred := make(map[ast.Node]bool)
+		for _, d := range deferStmts(fn.Body) {
+			deferred[d.Call] = true
+		}
+		g := Build(fset, fn.Body, func(x ast.Node) bool {
+			return isIdentOrAssign(x) || deferred[x]
+		})
 		dot := g.Dot(nil)
 		base := strings.TrimSuffix(file, ".go")
 		golden, _ := ioutil.ReadFile(base + ".dot")
@@ -110,9 +118,497 @@ func TestFlowdef(t *testing.T) {
 			t.Errorf("%s: wrong dataflow; have %s.reach.xxx, want %s.reach", file, base, base)
 			continue
 		}
+
+		// Backward, the same computation finds the next updates
+		// that can follow each node.
+		m = newIdentMatcher(fset)
+		g.DataflowBackward(m)
+
+		buf.Reset()
+		for _, x := range m.list {
+			fmt.Fprintf(&buf, "%s\n", m.nodeIn(x))
+		}
+		eq = buf.Bytes()
+		golden, _ = ioutil.ReadFile(base + ".next")
+		if !bytes.Equal(eq, golden) {
+			ioutil.WriteFile(base+".next.xxx", eq, 0666)
+			t.Errorf("%s: wrong backward dataflow; have %s.next.xxx, want %s.next", file, base, base)
+			continue
+		}
+	}
+}
+
+func TestReachingDefs(t *testing.T) {
+	matches, err := filepath.Glob("testdata/flowdef-*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) == 0 {
+		t.Fatal("no testdata found")
+	}
+	fset := token.NewFileSet()
+	for _, file := range matches {
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		fn, ok := f.Decls[len(f.Decls)-1].(*ast.FuncDecl)
+		if !ok {
+			t.Errorf("%s: found %T, want *ast.FuncDecl", file, f.Decls[0])
+			continue
+		}
+
+		d := ReachingDefs(fset, fn.Body, nil, nil)
+		var uses []*ast.Ident
+		for id := range d.UseDef {
+			uses = append(uses, id)
+		}
+		sort.Slice(uses, func(i, j int) bool { return uses[i].Pos() < uses[j].Pos() })
+		var buf bytes.Buffer
+		for _, id := range uses {
+			fmt.Fprintf(&buf, "%s:", nodeLabel(fset, id))
+			for _, def := range d.UseDef[id] {
+				fmt.Fprintf(&buf, " %s", nodeLabel(fset, def))
+				if !containsIdent(d.DefUse[def], id) {
+					t.Errorf("%s: DefUse of %s missing %s", file, nodeLabel(fset, def), nodeLabel(fset, id))
+				}
+			}
+			fmt.Fprintf(&buf, "\n")
+		}
+		base := strings.TrimSuffix(file, ".go")
+		out := buf.Bytes()
+		golden, _ := ioutil.ReadFile(base + ".defs")
+		if !bytes.Equal(out, golden) {
+			ioutil.WriteFile(base+".defs.xxx", out, 0666)
+			t.Errorf("%s: wrong reaching definitions; have %s.defs.xxx, want %s.defs", file, base, base)
+		}
+	}
+}
+
+func containsIdent(list []*ast.Ident, id *ast.Ident) bool {
+	for _, x := range list {
+		if x == id {
+			return true
+		}
+	}
+	return false
+}
+
+func TestPreds(t *testing.T) {
+	matches, err := filepath.Glob("testdata/cfg-*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	for _, file := range matches {
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		fn := f.Decls[len(f.Decls)-1].(*ast.FuncDecl)
+		g := Build(fset, fn.Body, isIdentOrAssign)
+
+		// Every edge from a reachable node appears exactly once in Preds,
+		// and Preds has no other edges.
+		edges := 0
+		for x, list := range g.Preds {
+			for _, y := range list {
+				if !containsNode(g.Follow[y], x) {
+					t.Errorf("%s: Preds edge %s <- %s not in Follow", file, nodeLabel(fset, x), nodeLabel(fset, y))
+				}
+				edges++
+			}
+		}
+		seen := map[ast.Node]bool{g.Start: true}
+		stack := []ast.Node{g.Start}
+		for len(stack) > 0 {
+			x := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			for _, y := range g.Follow[x] {
+				if !containsNode(g.Preds[y], x) {
+					t.Errorf("%s: Follow edge %s -> %s not in Preds", file, nodeLabel(fset, x), nodeLabel(fset, y))
+				}
+				edges--
+				if !seen[y] {
+					seen[y] = true
+					stack = append(stack, y)
+				}
+			}
+		}
+		if edges != 0 {
+			t.Errorf("%s: Preds and Follow have different numbers of edges", file)
+		}
+		if len(g.Preds[g.Start]) != 0 {
+			t.Errorf("%s: Start has predecessors", file)
+		}
 	}
 }
 
+func TestConfigTerminates(t *testing.T) {
+	const src = `package p
+
+func f() {
+	if a {
+		die()
+		b = 1
+	}
+	c = 1
+}
+`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "die.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := f.Decls[0].(*ast.FuncDecl)
+	ids := make(map[string]*ast.Ident)
+	ast.Inspect(fn.Body, func(x ast.Node) bool {
+		if id, ok := x.(*ast.Ident); ok {
+			ids[id.Name] = id
+		}
+		return true
+	})
+
+	g := Build(fset, fn.Body, isIdentOrAssign)
+	if len(g.Preds[ids["b"]]) == 0 {
+		t.Errorf("default config: b unreachable after die()")
+	}
+
+	cfg := &Config{
+		Terminates: func(call *ast.CallExpr) Termination {
+			if id, ok := call.Fun.(*ast.Ident); ok && id.Name == "die" {
+				return Exits
+			}
+			return DefaultTerminates(call)
+		},
+	}
+	g = cfg.Build(fset, fn.Body, isIdentOrAssign)
+	if len(g.Preds[ids["b"]]) != 0 {
+		t.Errorf("custom config: b reachable after die()")
+	}
+	if !containsNode(g.Follow[ids["die"]], g.End) {
+		t.Errorf("custom config: die() does not lead to End")
+	}
+	if len(g.Preds[ids["c"]]) == 0 {
+		t.Errorf("custom config: c unreachable")
+	}
+}
+
+func TestConfigConstant(t *testing.T) {
+	const src = `package p
+
+func f() {
+	if never {
+		a = 1
+	}
+	for always {
+		if x && never {
+			b = 1
+		}
+	}
+	c = 1
+}
+`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "const.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := f.Decls[0].(*ast.FuncDecl)
+	ids := make(map[string]*ast.Ident)
+	ast.Inspect(fn.Body, func(x ast.Node) bool {
+		if id, ok := x.(*ast.Ident); ok {
+			ids[id.Name] = id
+		}
+		return true
+	})
+
+	g := Build(fset, fn.Body, isIdentOrAssign)
+	for _, name := range []string{"a", "b", "c"} {
+		if len(g.Preds[ids[name]]) == 0 {
+			t.Errorf("default config: %s unreachable", name)
+		}
+	}
+
+	cfg := &Config{
+		Constant: func(cond ast.Expr) (value, ok bool) {
+			if id, ok := cond.(*ast.Ident); ok {
+				switch id.Name {
+				case "always":
+					return true, true
+				case "never":
+					return false, true
+				}
+			}
+			return false, false
+		},
+	}
+	g = cfg.Build(fset, fn.Body, isIdentOrAssign)
+	for _, name := range []string{"a", "b", "c"} {
+		if len(g.Preds[ids[name]]) != 0 {
+			t.Errorf("custom config: %s reachable", name)
+		}
+	}
+	if len(g.Preds[ids["x"]]) == 0 {
+		t.Errorf("custom config: x unreachable")
+	}
+}
+
+func TestEdgeKinds(t *testing.T) {
+	const src = `package p
+
+func f() {
+	if a && b {
+		c()
+	}
+	for e {
+		if f1 {
+			break
+		}
+		if f2 {
+			continue
+		}
+		g1()
+	}
+	switch h {
+	case i:
+		j()
+		fallthrough
+	case k:
+		l()
+	}
+	if m {
+		goto L
+	}
+	if n {
+		panic(o)
+	}
+	if p {
+		os.Exit(q)
+	}
+L:
+	r()
+	return
+}
+`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "kind.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := f.Decls[0].(*ast.FuncDecl)
+	ids := make(map[string]ast.Node)
+	ast.Inspect(fn.Body, func(x ast.Node) bool {
+		if id, ok := x.(*ast.Ident); ok {
+			ids[id.Name] = id
+		}
+		return true
+	})
+	g := Build(fset, fn.Body, isIdentOrAssign)
+	ids["End"] = g.End
+
+	var tests = []struct {
+		from, to string
+		kind     EdgeKind
+	}{
+		{"a", "b", EdgeTrue},
+		{"a", "e", EdgeFalse},
+		{"b", "c", EdgeTrue},
+		{"c", "e", 0},
+		{"e", "f1", EdgeTrue},
+		{"e", "h", EdgeFalse},
+		{"f1", "h", EdgeTrue | EdgeBreak},
+		{"f2", "e", EdgeTrue | EdgeContinue},
+		{"i", "j", EdgeTrue},
+		{"i", "k", EdgeFalse},
+		{"j", "l", EdgeFallthrough},
+		{"m", "r", EdgeTrue | EdgeGoto},
+		{"o", "End", EdgePanic},
+		{"q", "End", EdgeExit},
+		{"r", "End", EdgeReturn},
+	}
+	for _, tt := range tests {
+		x, y := ids[tt.from], ids[tt.to]
+		if !containsNode(g.Follow[x], y) {
+			t.Errorf("no edge %s -> %s", tt.from, tt.to)
+			continue
+		}
+		if k := g.Kind(x, y); k != tt.kind {
+			t.Errorf("Kind(%s, %s) = %q, want %q", tt.from, tt.to, k, tt.kind)
+		}
+	}
+}
+
+func TestFuncLits(t *testing.T) {
+	const src = `package p
+
+func f() {
+	func() {
+		a()
+	}()
+	defer func() {
+		b()
+	}()
+	go func() {
+		c()
+	}()
+	g := func() {
+		func() {
+			d()
+		}()
+	}
+	g()
+	for range func(yield func() bool) {
+		e()
+	} {
+	}
+}
+`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "lit.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := f.Decls[0].(*ast.FuncDecl)
+	isLitOrCall := func(x ast.Node) bool {
+		switch x.(type) {
+		case *ast.FuncLit, *ast.CallExpr:
+			return true
+		}
+		return false
+	}
+	g := Build(fset, fn.Body, isLitOrCall)
+
+	// Name each literal by the function its body calls.
+	lits := make(map[string]*ast.FuncLit)
+	ast.Inspect(fn.Body, func(x ast.Node) bool {
+		if lit, ok := x.(*ast.FuncLit); ok {
+			stmt := lit.Body.List[0].(*ast.ExprStmt)
+			if id, ok := stmt.X.(*ast.CallExpr).Fun.(*ast.Ident); ok {
+				lits[id.Name] = lit
+			} else {
+				lits["g"] = lit
+			}
+		}
+		return true
+	})
+
+	if len(g.Funcs) != 5 {
+		t.Errorf("len(g.Funcs) = %d, want 5", len(g.Funcs))
+	}
+	for _, name := range []string{"a", "b", "c", "e", "g"} {
+		sub := g.Funcs[lits[name]]
+		if sub == nil {
+			t.Errorf("no graph for literal calling %s", name)
+			continue
+		}
+		if sub.Parent != g || sub.Lit != lits[name] {
+			t.Errorf("literal calling %s: wrong Parent or Lit", name)
+		}
+		if len(g.Preds[lits[name]]) == 0 {
+			t.Errorf("literal calling %s: not reachable in enclosing graph", name)
+		}
+	}
+	inner := g.Funcs[lits["g"]].Funcs[lits["d"]]
+	if inner == nil || inner.Parent != g.Funcs[lits["g"]] {
+		t.Errorf("nested literal: wrong graph")
+	}
+
+	for _, name := range []string{"a", "b"} {
+		calls := g.Calls[lits[name]]
+		if len(calls) != 1 || len(g.Preds[calls[0]]) == 0 {
+			t.Errorf("literal calling %s: Calls = %v, want one reachable call", name, calls)
+		}
+	}
+	if calls := g.Calls[lits["e"]]; len(calls) != 1 {
+		t.Errorf("literal calling e: Calls = %v, want the range statement", calls)
+	} else if _, ok := calls[0].(*ast.RangeStmt); !ok {
+		t.Errorf("literal calling e: Calls = %v, want the range statement", calls)
+	}
+	deferred := g.Calls[lits["b"]][0]
+	if !containsNode(g.Follow[deferred], g.End) {
+		t.Errorf("deferred call does not lead to End")
+	}
+	for _, name := range []string{"c", "g"} {
+		if calls := g.Calls[lits[name]]; len(calls) != 0 {
+			t.Errorf("literal calling %s: Calls = %v, want none", name, calls)
+		}
+	}
+	for x := range g.Preds {
+		if call, ok := x.(*ast.CallExpr); ok && call.Fun == lits["c"] {
+			t.Errorf("go statement call appears in graph")
+		}
+	}
+}
+
+// alwaysChanged is a Computation whose Join always reports a change.
+type alwaysChanged struct{}
+
+func (alwaysChanged) Init(ast.Node)                {}
+func (alwaysChanged) Transfer(ast.Node)            {}
+func (alwaysChanged) Join(ast.Node, ast.Node) bool { return true }
+
+func TestSolve(t *testing.T) {
+	matches, err := filepath.Glob("testdata/cfg-*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	for _, file := range matches {
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		fn := f.Decls[len(f.Decls)-1].(*ast.FuncDecl)
+		g := Build(fset, fn.Body, isIdentOrAssign)
+
+		for _, backward := range []bool{false, true} {
+			root, succ := g.Start, g.Follow
+			if backward {
+				root, succ = g.End, g.Preds
+			}
+			index := reversePostorder(root, succ)
+			loop := false
+			for x := range index {
+				for _, y := range succ[x] {
+					if index[y] <= index[x] {
+						loop = true
+					}
+				}
+			}
+
+			// Without loops, reverse postorder visits each node once,
+			// even if every Join reports a change.
+			// With loops, such a computation never converges.
+			opts := DataflowOptions{Backward: backward, MaxVisits: 1}
+			if loop {
+				opts.MaxVisits = 10
+			}
+			stats, err := g.Solve(alwaysChanged{}, opts)
+			switch {
+			case loop && err == nil:
+				t.Errorf("%s (backward=%v): Solve converged with always-changing Join", file, backward)
+			case !loop && err != nil:
+				t.Errorf("%s (backward=%v): %v", file, backward, err)
+			case !loop && (stats.Nodes != len(index) || stats.Transfers != len(index)):
+				t.Errorf("%s (backward=%v): visited %d nodes with %d transfers, want %d", file, backward, stats.Nodes, stats.Transfers, len(index))
+			}
+		}
+	}
+}
+
+func containsNode(list []ast.Node, x ast.Node) bool {
+	for _, y := range list {
+		if y == x {
+			return true
+		}
+	}
+	return false
+}
+
 func identUpdate(x ast.Node) bool {
 	switch x := x.(type) {
 	case *ast.DeclStmt:
@@ -0,0 +1,178 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package flow
+
+import "go/ast"
+
+// A DomTree is a dominator (or post-dominator) tree
+// over the nodes of a Graph.
+//
+// The trees are computed using the iterative algorithm in
+// Cooper, Harvey, and Kennedy, "A Simple, Fast Dominance Algorithm".
+type DomTree struct {
+	Root     ast.Node                // Start for dominators, End for post-dominators
+	Idom     map[ast.Node]ast.Node   // immediate dominator of each node except Root
+	Children map[ast.Node][]ast.Node // inverse of Idom
+	Frontier map[ast.Node][]ast.Node // dominance frontier of each node
+
+	// Interval numbering of the tree, for constant-time Dominates.
+	pre  map[ast.Node]int
+	post map[ast.Node]int
+}
+
+// Dominators returns the dominator tree of g, rooted at g.Start.
+// Nodes unreachable from Start are not in the tree.
+func (g *Graph) Dominators() *DomTree {
+	return buildDomTree(g.Start, g.Follow, g.Preds)
+}
+
+// PostDominators returns the post-dominator tree of g, rooted at g.End.
+// Nodes from which End is unreachable, such as the nodes in
+// an infinite loop, are not in the tree.
+// The frontiers of the post-dominator tree give the
+// control dependences of the graph.
+func (g *Graph) PostDominators() *DomTree {
+	return buildDomTree(g.End, g.Preds, g.Follow)
+}
+
+// Dominates reports whether a dominates b in t.
+// Every node in the tree dominates itself.
+func (t *DomTree) Dominates(a, b ast.Node) bool {
+	pa, ok1 := t.pre[a]
+	pb, ok2 := t.pre[b]
+	return ok1 && ok2 && pa <= pb && t.post[b] <= t.post[a]
+}
+
+// StrictlyDominates reports whether a dominates b in t and a != b.
+func (t *DomTree) StrictlyDominates(a, b ast.Node) bool {
+	return a != b && t.Dominates(a, b)
+}
+
+func buildDomTree(root ast.Node, succ, pred map[ast.Node][]ast.Node) *DomTree {
+	t := &DomTree{
+		Root:     root,
+		Idom:     make(map[ast.Node]ast.Node),
+		Children: make(map[ast.Node][]ast.Node),
+		Frontier: make(map[ast.Node][]ast.Node),
+		pre:      make(map[ast.Node]int),
+		post:     make(map[ast.Node]int),
+	}
+	if root == nil {
+		return t
+	}
+
+	// Number nodes in postorder.
+	// The walks here are iterative; machine-generated
+	// functions can be too large for recursion.
+	type frame struct {
+		x ast.Node
+		i int
+	}
+	order := map[ast.Node]int{root: -1}
+	var postorder []ast.Node
+	stack := []frame{{root, 0}}
+	for len(stack) > 0 {
+		f := &stack[len(stack)-1]
+		if f.i < len(succ[f.x]) {
+			y := succ[f.x][f.i]
+			f.i++
+			if _, ok := order[y]; !ok {
+				order[y] = -1
+				stack = append(stack, frame{y, 0})
+			}
+			continue
+		}
+		order[f.x] = len(postorder)
+		postorder = append(postorder, f.x)
+		stack = stack[:len(stack)-1]
+	}
+
+	intersect := func(a, b ast.Node) ast.Node {
+		for a != b {
+			for order[a] < order[b] {
+				a = t.Idom[a]
+			}
+			for order[b] < order[a] {
+				b = t.Idom[b]
+			}
+		}
+		return a
+	}
+
+	t.Idom[root] = root
+	for changed := true; changed; {
+		changed = false
+		for i := len(postorder) - 2; i >= 0; i-- {
+			x := postorder[i]
+			var idom ast.Node
+			for _, p := range pred[x] {
+				if _, ok := order[p]; !ok || t.Idom[p] == nil {
+					continue
+				}
+				if idom == nil {
+					idom = p
+				} else {
+					idom = intersect(p, idom)
+				}
+			}
+			if t.Idom[x] != idom {
+				t.Idom[x] = idom
+				changed = true
+			}
+		}
+	}
+	delete(t.Idom, root)
+
+	for i := len(postorder) - 1; i >= 0; i-- {
+		x := postorder[i]
+		if x != root {
+			t.Children[t.Idom[x]] = append(t.Children[t.Idom[x]], x)
+		}
+	}
+
+	// Frontiers.
+	for i := len(postorder) - 1; i >= 0; i-- {
+		x := postorder[i]
+		var preds []ast.Node
+		for _, p := range pred[x] {
+			if _, ok := order[p]; ok {
+				preds = append(preds, p)
+			}
+		}
+		if len(preds) < 2 {
+			continue
+		}
+		for _, p := range preds {
+			for r := p; r != t.Idom[x] && r != nil; r = t.Idom[r] {
+				if list := t.Frontier[r]; len(list) == 0 || list[len(list)-1] != x {
+					t.Frontier[r] = append(list, x)
+				}
+				if r == root {
+					break
+				}
+			}
+		}
+	}
+
+	// Interval numbering.
+	n := 1
+	t.pre[root] = 0
+	stack = append(stack[:0], frame{root, 0})
+	for len(stack) > 0 {
+		f := &stack[len(stack)-1]
+		if f.i < len(t.Children[f.x]) {
+			y := t.Children[f.x][f.i]
+			f.i++
+			t.pre[y] = n
+			n++
+			stack = append(stack, frame{y, 0})
+			continue
+		}
+		t.post[f.x] = n
+		n++
+		stack = stack[:len(stack)-1]
+	}
+	return t
+}
@@ -0,0 +1,119 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package flow
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDomGolden(t *testing.T) {
+	matches, err := filepath.Glob("testdata/cfg-*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) == 0 {
+		t.Fatal("no testdata found")
+	}
+	fset := token.NewFileSet()
+	for _, file := range matches {
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		fn, ok := f.Decls[len(f.Decls)-1].(*ast.FuncDecl)
+		if !ok {
+			t.Errorf("%s: found %T, want *ast.FuncDecl", file, f.Decls[0])
+			continue
+		}
+
+		g := Build(fset, fn.Body, isIdentOrAssign)
+		dom := g.Dominators()
+		pdom := g.PostDominators()
+		checkDom(t, file, g, dom, g.Start, g.Follow)
+		checkDom(t, file, g, pdom, g.End, g.Preds)
+
+		out := dumpDom(g, dom, pdom)
+		base := strings.TrimSuffix(file, ".go")
+		golden, _ := ioutil.ReadFile(base + ".dom")
+		if bytes.Equal(out, golden) {
+			continue
+		}
+		ioutil.WriteFile(base+".dom.xxx", out, 0666)
+		t.Errorf("%s: wrong dominators; have %s.dom.xxx, want %s.dom", file, base, base)
+	}
+}
+
+// dumpDom prints the dominator information for g,
+// naming nodes as in the .dot files.
+func dumpDom(g *Graph, dom, pdom *DomTree) []byte {
+	p := &printer{
+		visited: make(map[ast.Node]bool),
+		id:      make(map[ast.Node]int),
+		edge:    func(src, dst ast.Node) string { return "" },
+		g:       g,
+	}
+	p.print(g.Start)
+	nodes := make([]ast.Node, len(p.id)+1)
+	for x, id := range p.id {
+		nodes[id] = x
+	}
+	names := func(list []ast.Node) string {
+		var s []string
+		for _, x := range list {
+			s = append(s, p.name(x))
+		}
+		return strings.Join(s, " ")
+	}
+
+	var buf bytes.Buffer
+	for _, x := range nodes[1:] {
+		fmt.Fprintf(&buf, "%s: idom=%s ipdom=%s df=[%s] pdf=[%s]\n", p.name(x),
+			p.name(dom.Idom[x]), p.name(pdom.Idom[x]), names(dom.Frontier[x]), names(pdom.Frontier[x]))
+	}
+	return buf.Bytes()
+}
+
+// checkDom checks Dominates against the definition:
+// a dominates b if every path from the root to b passes through a.
+func checkDom(t *testing.T, file string, g *Graph, tree *DomTree, root ast.Node, succ map[ast.Node][]ast.Node) {
+	reach := func(avoid ast.Node) map[ast.Node]bool {
+		seen := make(map[ast.Node]bool)
+		if root == avoid {
+			return seen
+		}
+		seen[root] = true
+		stack := []ast.Node{root}
+		for len(stack) > 0 {
+			x := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			for _, y := range succ[x] {
+				if y != avoid && !seen[y] {
+					seen[y] = true
+					stack = append(stack, y)
+				}
+			}
+		}
+		return seen
+	}
+	all := reach(nil)
+	for a := range all {
+		without := reach(a)
+		for b := range all {
+			want := a == b || !without[b]
+			if have := tree.Dominates(a, b); have != want {
+				t.Errorf("%s: Dominates(%s, %s) = %v, want %v", file, nodeLabel(g.FileSet, a), nodeLabel(g.FileSet, b), have, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package flow
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+// nodeOrder returns the nodes reachable from g.Start in the
+// depth-first preorder used to number them in Dot.
+func (g *Graph) nodeOrder() []ast.Node {
+	if g.Start == nil {
+		return nil
+	}
+	// Iterative depth-first search; machine-generated
+	// functions can be too large for recursion.
+	type frame struct {
+		x ast.Node
+		i int
+	}
+	list := []ast.Node{g.Start}
+	seen := map[ast.Node]bool{g.Start: true}
+	stack := []frame{{g.Start, 0}}
+	for len(stack) > 0 {
+		f := &stack[len(stack)-1]
+		if f.i == len(g.Follow[f.x]) {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		y := g.Follow[f.x][f.i]
+		f.i++
+		if y == nil || seen[y] {
+			continue
+		}
+		seen[y] = true
+		list = append(list, y)
+		stack = append(stack, frame{y, 0})
+	}
+	return list
+}
+
+type jsonGraph struct {
+	Start string     `json:"start"`
+	End   string     `json:"end,omitempty"`
+	Nodes []jsonNode `json:"nodes"`
+	Edges []jsonEdge `json:"edges"`
+}
+
+type jsonNode struct {
+	ID    string `json:"id"`
+	Type  string `json:"type"`
+	Name  string `json:"name,omitempty"`
+	File  string `json:"file,omitempty"`
+	Line  int    `json:"line,omitempty"`
+	Label string `json:"label"`
+}
+
+type jsonEdge struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Kind  string `json:"kind,omitempty"`
+	Label string `json:"label,omitempty"`
+}
+
+// JSON returns a JSON encoding of g, with the same node names as Dot.
+// Each edge records its kind, and if edge is not nil,
+// it is called to label each edge.
+func (g *Graph) JSON(edge func(src, dst ast.Node) string) ([]byte, error) {
+	order := g.nodeOrder()
+	id := make(map[ast.Node]string)
+	for i, x := range order {
+		id[x] = fmt.Sprintf("n%d", i+1)
+	}
+	jg := &jsonGraph{
+		Start: id[g.Start],
+		End:   id[g.End],
+		Nodes: []jsonNode{},
+		Edges: []jsonEdge{},
+	}
+	for _, x := range order {
+		n := jsonNode{
+			ID:    id[x],
+			Type:  fmt.Sprintf("%T", x),
+			Label: nodeLabel(g.FileSet, x),
+		}
+		switch x := x.(type) {
+		case *ast.Ident:
+			n.Name = x.Name
+		case *ast.SelectorExpr:
+			n.Name = x.Sel.Name
+		}
+		if x.Pos().IsValid() {
+			pos := g.FileSet.Position(x.Pos())
+			n.File = pos.Filename
+			n.Line = pos.Line
+		}
+		jg.Nodes = append(jg.Nodes, n)
+		for i, y := range g.Follow[x] {
+			e := jsonEdge{From: id[x], To: id[y], Kind: g.Kinds[x][i].String()}
+			if edge != nil {
+				e.Label = edge(x, y)
+			}
+			jg.Edges = append(jg.Edges, e)
+		}
+	}
+	return json.MarshalIndent(jg, "", "\t")
+}
+
+var mermaidEscaper = strings.NewReplacer(
+	`"`, `#quot;`,
+	"\n", `<br>`,
+)
+
+// Mermaid returns a Mermaid flowchart of g, with the same node names as Dot.
+// If edge is not nil, it is called to label each edge;
+// as in Dot, a label beginning with ! marks the edge in red.
+// If edge is nil, each edge is labeled with its kind.
+func (g *Graph) Mermaid(edge func(src, dst ast.Node) string) []byte {
+	if edge == nil {
+		edge = g.kindLabel
+	}
+	order := g.nodeOrder()
+	id := make(map[ast.Node]string)
+	for i, x := range order {
+		id[x] = fmt.Sprintf("n%d", i+1)
+	}
+	var buf bytes.Buffer
+	var red []int
+	nedge := 0
+	fmt.Fprintf(&buf, "flowchart TD\n")
+	for _, x := range order {
+		fmt.Fprintf(&buf, "\t%s[\"%s\"]\n", id[x], mermaidEscaper.Replace(nodeLabel(g.FileSet, x)))
+	}
+	for _, x := range order {
+		for _, y := range g.Follow[x] {
+			label := edge(x, y)
+			if strings.HasPrefix(label, "!") {
+				label = label[1:]
+				red = append(red, nedge)
+			}
+			if label == "" {
+				fmt.Fprintf(&buf, "\t%s --> %s\n", id[x], id[y])
+			} else {
+				fmt.Fprintf(&buf, "\t%s -->|\"%s\"| %s\n", id[x], mermaidEscaper.Replace(label), id[y])
+			}
+			nedge++
+		}
+	}
+	for _, i := range red {
+		fmt.Fprintf(&buf, "\tlinkStyle %d stroke:red\n", i)
+	}
+	return buf.Bytes()
+}
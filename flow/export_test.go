@@ -0,0 +1,116 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package flow
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var (
+	dotNode = regexp.MustCompile(`(?m)^(n[0-9]+) \[label="(.*)"\];$`)
+	dotEdge = regexp.MustCompile(`(?m)^(n[0-9]+) -> (n[0-9]+) \[label="(.*)"\];$`)
+)
+
+func TestJSON(t *testing.T) {
+	matches, err := filepath.Glob("testdata/cfg-*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	for _, file := range matches {
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		fn := f.Decls[len(f.Decls)-1].(*ast.FuncDecl)
+		g := Build(fset, fn.Body, isIdentOrAssign)
+		edge := func(src, dst ast.Node) string {
+			if dst == g.End {
+				return "exit"
+			}
+			return ""
+		}
+
+		// The JSON must describe the same graph as Dot.
+		var want, have []string
+		dot := g.Dot(edge)
+		for _, m := range dotNode.FindAllSubmatch(dot, -1) {
+			want = append(want, fmt.Sprintf("%s %s", m[1], m[2]))
+		}
+		for _, m := range dotEdge.FindAllSubmatch(dot, -1) {
+			want = append(want, fmt.Sprintf("%s -> %s %s", m[1], m[2], m[3]))
+		}
+
+		data, err := g.JSON(edge)
+		if err != nil {
+			t.Errorf("%s: %v", file, err)
+			continue
+		}
+		var jg jsonGraph
+		if err := json.Unmarshal(data, &jg); err != nil {
+			t.Errorf("%s: invalid JSON: %v", file, err)
+			continue
+		}
+		for _, n := range jg.Nodes {
+			have = append(have, fmt.Sprintf("%s %s", n.ID, n.Label))
+		}
+		for _, e := range jg.Edges {
+			have = append(have, fmt.Sprintf("%s -> %s %s", e.From, e.To, e.Label))
+		}
+		if jg.Start != "n1" {
+			t.Errorf("%s: start = %q, want n1", file, jg.Start)
+		}
+
+		sort.Strings(want)
+		sort.Strings(have)
+		if strings.Join(have, "\n") != strings.Join(want, "\n") {
+			t.Errorf("%s: JSON and Dot differ:\nJSON:\n%s\nDot:\n%s", file, strings.Join(have, "\n"), strings.Join(want, "\n"))
+		}
+	}
+}
+
+func TestMermaidGolden(t *testing.T) {
+	matches, err := filepath.Glob("testdata/cfg-*.mmd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) == 0 {
+		t.Fatal("no testdata found")
+	}
+	fset := token.NewFileSet()
+	for _, golden := range matches {
+		file := strings.TrimSuffix(golden, ".mmd") + ".go"
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		fn := f.Decls[len(f.Decls)-1].(*ast.FuncDecl)
+		g := Build(fset, fn.Body, isIdentOrAssign)
+		out := g.Mermaid(func(src, dst ast.Node) string {
+			if dst == g.End {
+				return "!exit"
+			}
+			return ""
+		})
+		want, _ := ioutil.ReadFile(golden)
+		if !bytes.Equal(out, want) {
+			ioutil.WriteFile(golden+".xxx", out, 0666)
+			t.Errorf("%s: wrong graph; have %s.xxx, want %s", file, golden, golden)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package flow
+
+import "go/ast"
+
+// A Lattice describes the facts computed by an Analysis.
+type Lattice[F any] interface {
+	Bottom() F     // fact holding no information
+	Join(a, b F) F // least upper bound of a and b; must not modify a or b
+	Equal(a, b F) bool
+}
+
+// An Analysis is a dataflow analysis computing facts of type F
+// at each node of a graph. It is a simpler alternative to implementing
+// Computation directly: the analysis supplies only the lattice and the
+// transfer function, and Run keeps the facts for each node.
+type Analysis[F any] struct {
+	Lattice Lattice[F]
+
+	// Transfer returns the fact holding after x given the fact holding
+	// before it, or, for a backward analysis, the fact holding before x
+	// given the fact holding after it. It must not modify its argument.
+	Transfer func(x ast.Node, f F) F
+
+	// Entry is the fact holding at the start of the analysis:
+	// before Start, or, for a backward analysis, after End.
+	Entry F
+
+	Backward  bool
+	MaxVisits int // see DataflowOptions
+}
+
+// Facts holds the result of running an Analysis.
+// In and Out give the facts holding before and after each node,
+// in the order of execution, whether the analysis is forward or backward.
+// Nodes not visited by the analysis have no entries.
+type Facts[F any] struct {
+	In    map[ast.Node]F
+	Out   map[ast.Node]F
+	Stats DataflowStats
+}
+
+// Run runs the analysis a over g until it reaches a fixed point.
+// It returns an error only if a.MaxVisits is exceeded,
+// in which case the facts are incomplete.
+func (a *Analysis[F]) Run(g *Graph) (*Facts[F], error) {
+	facts := &Facts[F]{
+		In:  make(map[ast.Node]F),
+		Out: make(map[ast.Node]F),
+	}
+	c := &analysisComputation[F]{a: a, src: facts.In, dst: facts.Out}
+	if a.Backward {
+		c.src, c.dst = facts.Out, facts.In
+	}
+	var err error
+	facts.Stats, err = g.Solve(c, DataflowOptions{Backward: a.Backward, MaxVisits: a.MaxVisits})
+	return facts, err
+}
+
+// An analysisComputation adapts an Analysis to the Computation interface.
+// The facts flow from src, the side of each node where the analysis enters,
+// to dst, the side where it leaves.
+type analysisComputation[F any] struct {
+	a   *Analysis[F]
+	src map[ast.Node]F
+	dst map[ast.Node]F
+}
+
+func (c *analysisComputation[F]) Init(x ast.Node) {
+	c.src[x] = c.a.Entry
+}
+
+func (c *analysisComputation[F]) Transfer(x ast.Node) {
+	f, ok := c.src[x]
+	if !ok {
+		f = c.a.Lattice.Bottom()
+	}
+	c.dst[x] = c.a.Transfer(x, f)
+}
+
+func (c *analysisComputation[F]) Join(y, x ast.Node) bool {
+	old, ok := c.src[y]
+	if !ok {
+		c.src[y] = c.dst[x]
+		return true
+	}
+	f := c.a.Lattice.Join(old, c.dst[x])
+	if c.a.Lattice.Equal(old, f) {
+		return false
+	}
+	c.src[y] = f
+	return true
+}
@@ -0,0 +1,93 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package flow
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"testing"
+)
+
+// A nodeSet is the lattice of sets of nodes, in the order added.
+type nodeSet struct{}
+
+func (nodeSet) Bottom() []ast.Node { return nil }
+
+func (nodeSet) Join(a, b []ast.Node) []ast.Node { return mergef(a, b) }
+
+// Equal is only used to compare a set with its join with another,
+// which can only have gained nodes.
+func (nodeSet) Equal(a, b []ast.Node) bool { return len(a) == len(b) }
+
+// updates is identMatcher written as an Analysis.
+func updates(backward bool) *Analysis[[]ast.Node] {
+	return &Analysis[[]ast.Node]{
+		Lattice: nodeSet{},
+		Transfer: func(x ast.Node, f []ast.Node) []ast.Node {
+			switch x := x.(type) {
+			case *ast.DeclStmt, *ast.IncDecStmt:
+				return []ast.Node{x}
+			case *ast.AssignStmt:
+				for _, y := range x.Lhs {
+					if _, ok := unparen(y).(*ast.Ident); ok {
+						return []ast.Node{x}
+					}
+				}
+			}
+			return f
+		},
+		Backward: backward,
+	}
+}
+
+func TestAnalysis(t *testing.T) {
+	matches, err := filepath.Glob("testdata/flowdef-*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) == 0 {
+		t.Fatal("no testdata found")
+	}
+	fset := token.NewFileSet()
+	for _, file := range matches {
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		fn := f.Decls[len(f.Decls)-1].(*ast.FuncDecl)
+		g := Build(fset, fn.Body, identUpdate)
+
+		for _, backward := range []bool{false, true} {
+			m := newIdentMatcher(fset)
+			if backward {
+				g.DataflowBackward(m)
+			} else {
+				g.Dataflow(m)
+			}
+			facts, err := updates(backward).Run(g)
+			if err != nil {
+				t.Errorf("%s: %v", file, err)
+				continue
+			}
+			in := facts.In
+			if backward {
+				in = facts.Out
+			}
+			if len(in) != len(m.list) {
+				t.Errorf("%s (backward=%v): facts for %d nodes, want %d", file, backward, len(in), len(m.list))
+			}
+			for _, x := range m.list {
+				have := (&identMatcher{in: in, fset: fset}).nodeIn(x)
+				want := m.nodeIn(x)
+				if have != want {
+					t.Errorf("%s (backward=%v): have %s, want %s", file, backward, have, want)
+				}
+			}
+		}
+	}
+}
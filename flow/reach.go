@@ -0,0 +1,352 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package flow
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// Defs holds the reaching definitions for the variables of a function body.
+//
+// A definition is a node that gives a variable a new value:
+// a *ast.DeclStmt, *ast.AssignStmt, *ast.IncDecStmt, or *ast.RangeStmt.
+// In addition, a use of a variable declared without an initializer
+// that can only see the declaration's implicit zero value is itself
+// treated as a definition of that zero value for the uses it reaches.
+// This lets each independent read of the zero value be handled separately.
+//
+// Once a variable's address has been taken, assignments to it no longer
+// kill its earlier definitions, since those may still be observed through
+// the pointer, and so all of them reach later uses.
+// A function literal referring to a variable is treated the same way,
+// as taking the variable's address at the point where the literal appears.
+// The literal's node is then a reference to the variable in Refs,
+// standing for the uses and assignments in its body.
+type Defs struct {
+	Graph  *Graph
+	UseDef map[*ast.Ident][]ast.Node  // definitions reaching each use
+	DefUse map[ast.Node][]*ast.Ident  // uses reached by each definition
+	Refs   map[*ast.Object][]ast.Node // nodes referring to each variable, in flow order
+	in     map[ast.Node]map[*ast.Object]defSet
+	out    map[ast.Node]map[*ast.Object]defSet
+	vars   map[*ast.Object]bool
+	addrOf func(*ast.UnaryExpr) *ast.Object
+}
+
+type defSet struct {
+	list      []ast.Node
+	addrTaken bool
+}
+
+// ReachingDefs computes the reaching definitions in body for the variables vars,
+// or, if vars is nil, for all variables declared in body outside function literals.
+// Variables are identified by their *ast.Object, so the parser's
+// identifier resolution must have been run on body.
+//
+// The function addrOf reports the variable, if any, whose address is taken by
+// a & expression. If addrOf is nil, every & expression is assumed to take the
+// address of the variable at the root of its operand, which is conservative
+// but treats &p.x as taking the address of p even when p is a pointer.
+func ReachingDefs(fset *token.FileSet, body *ast.BlockStmt, vars []*ast.Object, addrOf func(*ast.UnaryExpr) *ast.Object) *Defs {
+	d := &Defs{
+		UseDef: make(map[*ast.Ident][]ast.Node),
+		DefUse: make(map[ast.Node][]*ast.Ident),
+		Refs:   make(map[*ast.Object][]ast.Node),
+		in:     make(map[ast.Node]map[*ast.Object]defSet),
+		out:    make(map[ast.Node]map[*ast.Object]defSet),
+		vars:   make(map[*ast.Object]bool),
+		addrOf: addrOf,
+	}
+	if d.addrOf == nil {
+		d.addrOf = rootAddrOf
+	}
+	if vars == nil {
+		ast.Inspect(body, func(x ast.Node) bool {
+			if _, ok := x.(*ast.FuncLit); ok {
+				return false
+			}
+			if id, ok := x.(*ast.Ident); ok && id.Obj != nil && id.Obj.Kind == ast.Var {
+				if body.Pos() <= id.Obj.Pos() && id.Obj.Pos() < body.End() {
+					d.vars[id.Obj] = true
+				}
+			}
+			return true
+		})
+	}
+	for _, obj := range vars {
+		d.vars[obj] = true
+	}
+
+	d.Graph = Build(fset, body, func(x ast.Node) bool {
+		return len(d.refs(x)) > 0
+	})
+	d.Graph.Dataflow((*reacher)(d))
+
+	for _, x := range d.order() {
+		for _, obj := range d.refs(x) {
+			d.Refs[obj] = append(d.Refs[obj], x)
+		}
+		if id, ok := x.(*ast.Ident); ok && d.vars[id.Obj] {
+			switch def := d.assignedBy(id).(type) {
+			case nil:
+				d.addUse(id, d.in[x][id.Obj].list)
+			case *ast.IncDecStmt:
+				d.addUse(id, d.in[def][id.Obj].list)
+			case *ast.AssignStmt:
+				if def.Tok != token.ASSIGN && def.Tok != token.DEFINE {
+					d.addUse(id, d.in[def][id.Obj].list)
+				}
+			}
+		}
+		if decl, ok := x.(*ast.DeclStmt); ok {
+			// The flow graph does not descend into declarations,
+			// so uses in initializers see the definitions reaching the declaration.
+			for _, spec := range decl.Decl.(*ast.GenDecl).Specs {
+				if spec, ok := spec.(*ast.ValueSpec); ok {
+					for _, v := range spec.Values {
+						ast.Inspect(v, func(y ast.Node) bool {
+							if id, ok := y.(*ast.Ident); ok && d.vars[id.Obj] {
+								d.addUse(id, d.in[x][id.Obj].list)
+							}
+							return true
+						})
+					}
+				}
+			}
+		}
+	}
+	return d
+}
+
+// After returns the definitions of obj that reach the point just after x,
+// which must be one of the nodes in Refs[obj].
+// For a zero-value use, this is the use itself.
+func (d *Defs) After(x ast.Node, obj *ast.Object) []ast.Node {
+	return d.out[x][obj].list
+}
+
+func (d *Defs) addUse(id *ast.Ident, defs []ast.Node) {
+	d.UseDef[id] = defs
+	for _, def := range defs {
+		d.DefUse[def] = append(d.DefUse[def], id)
+	}
+}
+
+// order returns the nodes of the graph reachable from Start,
+// in breadth-first order.
+func (d *Defs) order() []ast.Node {
+	g := d.Graph
+	var list []ast.Node
+	seen := map[ast.Node]bool{g.Start: true}
+	queue := []ast.Node{g.Start}
+	for len(queue) > 0 {
+		x := queue[0]
+		queue = queue[1:]
+		if x != g.Start && x != g.End {
+			list = append(list, x)
+		}
+		for _, y := range g.Follow[x] {
+			if !seen[y] {
+				seen[y] = true
+				queue = append(queue, y)
+			}
+		}
+	}
+	return list
+}
+
+// assignedBy returns the definition, if any, that assigns to id.
+// The flow graph places an assigned identifier just after the
+// statement assigning it, so that statement reaches id.
+// An increment or operator assignment reads id before assigning it.
+func (d *Defs) assignedBy(id *ast.Ident) ast.Node {
+	for _, def := range d.in[id][id.Obj].list {
+		switch x := def.(type) {
+		case *ast.AssignStmt:
+			for _, y := range x.Lhs {
+				if unparen(y) == id {
+					return x
+				}
+			}
+		case *ast.IncDecStmt:
+			if unparen(x.X) == id {
+				return x
+			}
+		case *ast.RangeStmt:
+			if x.Key != nil && unparen(x.Key) == id || x.Value != nil && unparen(x.Value) == id {
+				return x
+			}
+		}
+	}
+	return nil
+}
+
+// refs returns the tracked variables that x defines, uses, or takes the address of.
+func (d *Defs) refs(x ast.Node) []*ast.Object {
+	var objs []*ast.Object
+	add := func(y ast.Expr) {
+		if id, ok := unparen(y).(*ast.Ident); ok && d.vars[id.Obj] {
+			objs = append(objs, id.Obj)
+		}
+	}
+	switch x := x.(type) {
+	case *ast.Ident:
+		if d.vars[x.Obj] {
+			objs = append(objs, x.Obj)
+		}
+	case *ast.UnaryExpr:
+		if x.Op == token.AND {
+			if obj := d.addrOf(x); d.vars[obj] {
+				objs = append(objs, obj)
+			}
+		}
+	case *ast.FuncLit:
+		seen := make(map[*ast.Object]bool)
+		ast.Inspect(x.Body, func(y ast.Node) bool {
+			if id, ok := y.(*ast.Ident); ok && d.vars[id.Obj] && !seen[id.Obj] {
+				seen[id.Obj] = true
+				objs = append(objs, id.Obj)
+			}
+			return true
+		})
+	case *ast.DeclStmt:
+		g := x.Decl.(*ast.GenDecl)
+		if g.Tok != token.VAR {
+			break
+		}
+		for _, spec := range g.Specs {
+			for _, id := range spec.(*ast.ValueSpec).Names {
+				add(id)
+			}
+		}
+	case *ast.AssignStmt:
+		for _, y := range x.Lhs {
+			add(y)
+		}
+	case *ast.IncDecStmt:
+		add(x.X)
+	case *ast.RangeStmt:
+		if x.Key != nil {
+			add(x.Key)
+		}
+		if x.Value != nil {
+			add(x.Value)
+		}
+	}
+	return objs
+}
+
+// A reacher implements Computation for the forward analysis.
+type reacher Defs
+
+func (d *reacher) Init(x ast.Node) {
+	d.in[x] = nil
+}
+
+func (d *reacher) Transfer(x ast.Node) {
+	in := d.in[x]
+	objs := (*Defs)(d).refs(x)
+	if len(objs) == 0 {
+		d.out[x] = in
+		return
+	}
+	out := make(map[*ast.Object]defSet, len(in))
+	for obj, s := range in {
+		out[obj] = s
+	}
+	for _, obj := range objs {
+		s := in[obj]
+		switch x := x.(type) {
+		case *ast.Ident:
+			if len(s.list) == 1 && !s.addrTaken && isZeroDecl(s.list[0], obj) {
+				s = defSet{[]ast.Node{x}, s.addrTaken}
+			}
+		case *ast.DeclStmt:
+			s = defSet{[]ast.Node{x}, false}
+		case *ast.UnaryExpr, *ast.FuncLit:
+			s.addrTaken = true
+		case *ast.AssignStmt:
+			if s.addrTaken || x.Tok != token.ASSIGN && x.Tok != token.DEFINE {
+				s.list = mergef(s.list, []ast.Node{x})
+			} else {
+				s.list = []ast.Node{x}
+			}
+		case *ast.IncDecStmt:
+			s.list = mergef(s.list, []ast.Node{x})
+		case *ast.RangeStmt:
+			if s.addrTaken {
+				s.list = mergef(s.list, []ast.Node{x})
+			} else {
+				s.list = []ast.Node{x}
+			}
+		}
+		out[obj] = s
+	}
+	d.out[x] = out
+}
+
+func (d *reacher) Join(x, y ast.Node) bool {
+	in := d.in[x]
+	changed := false
+	for obj, sy := range d.out[y] {
+		sx := in[obj]
+		list := mergef(sx.list, sy.list)
+		if len(list) > len(sx.list) || !sx.addrTaken && sy.addrTaken {
+			if !changed {
+				// Copy on write: in may be shared with another node's out.
+				m := make(map[*ast.Object]defSet, len(in)+1)
+				for k, v := range in {
+					m[k] = v
+				}
+				in = m
+				changed = true
+			}
+			in[obj] = defSet{list, sx.addrTaken || sy.addrTaken}
+		}
+	}
+	if changed {
+		d.in[x] = in
+	}
+	return changed
+}
+
+// isZeroDecl reports whether def declares obj without an initializer.
+func isZeroDecl(def ast.Node, obj *ast.Object) bool {
+	decl, ok := def.(*ast.DeclStmt)
+	if !ok {
+		return false
+	}
+	for _, spec := range decl.Decl.(*ast.GenDecl).Specs {
+		spec := spec.(*ast.ValueSpec)
+		for _, id := range spec.Names {
+			if id.Obj == obj {
+				return len(spec.Values) == 0
+			}
+		}
+	}
+	return false
+}
+
+// rootAddrOf returns the variable at the root of the operand of x.
+func rootAddrOf(x *ast.UnaryExpr) *ast.Object {
+	y := x.X
+	for {
+		switch yy := y.(type) {
+		case *ast.ParenExpr:
+			y = yy.X
+			continue
+		case *ast.SelectorExpr:
+			y = yy.X
+			continue
+		case *ast.IndexExpr:
+			y = yy.X
+			continue
+		case *ast.Ident:
+			return yy.Obj
+		}
+		return nil
+	}
+}
@@ -0,0 +1,14 @@
+package p
+
+func f() (x int) {
+	defer g(x)
+	if c {
+		defer func() {
+			x = 2
+		}()
+		return 1
+	}
+	y := 1
+	go h(y)
+	return y
+}
@@ -0,0 +1,20 @@
+package p
+
+func f(t *testing.T) {
+	defer cleanup()
+	switch {
+	case a:
+		panic(a)
+		a = 1
+	case b:
+		os.Exit(1)
+		b = 1
+	case c:
+		t.Fatal(c)
+		c = 1
+	case d:
+		log.Fatalf("%v", d)
+		d = 1
+	}
+	e = 1
+}
@@ -0,0 +1,30 @@
+package p
+
+func f() (x int) {
+	before()
+L:
+	for k, v := range seq {
+		defer cleanup(k)
+		if brk() {
+			break
+		}
+		if cont() {
+			continue
+		}
+		if ret() {
+			return v
+		}
+		for range inner {
+			if brkL() {
+				break L
+			}
+		}
+		if jump() {
+			goto out
+		}
+		body(k, v)
+	}
+	after()
+out:
+	return
+}
@@ -0,0 +1,18 @@
+package p
+
+func f() {
+	before()
+	for i := range n {
+		if brk(i) {
+			break
+		}
+		body(i)
+	}
+	for range 10 {
+		if cont() {
+			continue
+		}
+		more()
+	}
+	after()
+}
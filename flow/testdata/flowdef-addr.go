@@ -0,0 +1,21 @@
+package p
+
+func f() {
+	var x int
+	if c() {
+		use(x)
+	} else {
+		use(x)
+	}
+	x = 1
+	use(x)
+	p := &x
+	x = 2
+	*p = 3
+	use(x)
+	for i := range list {
+		x++
+		use(i)
+	}
+	use(x)
+}
@@ -0,0 +1,14 @@
+package p
+
+func f() {
+	var x, y int
+	x = 1
+	y = x
+	g := func() {
+		x = 2
+	}
+	x = 3
+	g()
+	y = x
+	println(y)
+}
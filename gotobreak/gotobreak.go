@@ -0,0 +1,187 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package gotobreak replaces gotos that leave or restart
+// an enclosing loop with break and continue statements.
+package gotobreak
+
+import (
+	"fmt"
+	"go/ast"
+	"sort"
+
+	"rsc.io/grind/block"
+	"rsc.io/grind/grinder"
+)
+
+func Grind(ctxt *grinder.Context, pkg *grinder.Package) {
+	grinder.GrindFuncDecls(ctxt, pkg, grindFunc)
+}
+
+func grindFunc(ctxt *grinder.Context, pkg *grinder.Package, edit *grinder.EditBuffer, fn *ast.FuncDecl) {
+	if fn.Body == nil {
+		return
+	}
+	b := &breaker{
+		edit:     edit,
+		blocks:   block.Build(pkg.FileSet, fn.Body),
+		parent:   make(map[ast.Stmt]ast.Node),
+		lits:     make(map[ast.Node]bool),
+		labels:   make(map[ast.Stmt]string),
+		named:    make(map[string]bool),
+		replaced: make(map[string]int),
+	}
+	ast.Inspect(fn.Body, func(x ast.Node) bool {
+		switch x := x.(type) {
+		case *ast.FuncLit:
+			b.lits[x.Body] = true
+		case *ast.LabeledStmt:
+			b.parent[x.Stmt] = x
+		}
+		for _, y := range grinder.BlockList(x) {
+			b.parent[y] = x
+		}
+		return true
+	})
+	// Visit the gotos in source order, so that added labels are numbered predictably.
+	var gotos []*ast.BranchStmt
+	for _, list := range b.blocks.Goto {
+		gotos = append(gotos, list...)
+	}
+	sort.Slice(gotos, func(i, j int) bool { return gotos[i].Pos() < gotos[j].Pos() })
+	for _, g := range gotos {
+		if b.rewrite(g) {
+			b.replaced[g.Label.Name]++
+		}
+	}
+
+	// Delete the target labels left unused, so that the result type-checks.
+	for name, n := range b.replaced {
+		if !b.named[name] && n == len(b.blocks.Goto[name])+len(b.blocks.Break[name])+len(b.blocks.Continue[name]) {
+			x := b.blocks.Label[name]
+			edit.DeleteLine(x.Pos(), x.Colon+1)
+		}
+	}
+}
+
+type breaker struct {
+	edit   *grinder.EditBuffer
+	blocks *block.Graph
+	parent map[ast.Stmt]ast.Node // statement -> enclosing list or labeled statement
+	lits   map[ast.Node]bool     // bodies of function literals
+	labels map[ast.Stmt]string   // labels added to loops
+	added  map[string]bool       // names of added labels
+
+	named    map[string]bool // existing labels named by new branch statements
+	replaced map[string]int  // number of gotos replaced, by label
+}
+
+// rewrite replaces g with a break or continue, if g leaves or restarts
+// an enclosing loop. It reports whether it replaced g.
+func (b *breaker) rewrite(g *ast.BranchStmt) bool {
+	target := b.blocks.Label[g.Label.Name]
+	if target == nil {
+		return false
+	}
+
+	// Walk outward through the statements enclosing g,
+	// noting whether a bare break or continue would still reach each loop.
+	bareBreak, bareContinue := true, true
+	for blk := b.blocks.Map[g]; blk != nil; blk = blk.Parent {
+		if b.lits[blk.Root] {
+			// Labels do not cross function boundaries.
+			return false
+		}
+		var body *ast.BlockStmt
+		switch x := blk.Root.(type) {
+		case *ast.SwitchStmt, *ast.TypeSwitchStmt:
+			bareBreak = false
+			continue
+		case *ast.CommClause:
+			// In a select statement.
+			bareBreak = false
+			continue
+		case *ast.ForStmt:
+			body = x.Body
+			if target.Stmt == x && x.Init == nil && x.Post == nil {
+				// Back to the top of a loop with nothing to initialize or skip.
+				b.replace(g, "continue", x, bareContinue)
+				return true
+			}
+		case *ast.RangeStmt:
+			body = x.Body
+		default:
+			continue
+		}
+		loop := blk.Root.(ast.Stmt)
+
+		if last := len(body.List) - 1; last >= 0 && body.List[last] == target && isEmpty(target.Stmt) {
+			// To the end of the loop body.
+			b.replace(g, "continue", loop, bareContinue)
+			return true
+		}
+		if b.after(loop) == target {
+			// To the statement following the loop.
+			b.replace(g, "break", loop, bareBreak)
+			return true
+		}
+		bareBreak, bareContinue = false, false
+	}
+	return false
+}
+
+// replace replaces g with the branch statement tok for loop,
+// naming the loop's label unless bare is set.
+func (b *breaker) replace(g *ast.BranchStmt, tok string, loop ast.Stmt, bare bool) {
+	if !bare {
+		tok += " " + b.label(loop)
+	}
+	b.edit.Replace(g.Pos(), g.End(), tok)
+}
+
+// label returns the label of loop, adding one if needed.
+func (b *breaker) label(loop ast.Stmt) string {
+	if l, ok := b.parent[loop].(*ast.LabeledStmt); ok {
+		b.named[l.Label.Name] = true
+		return l.Label.Name
+	}
+	if name := b.labels[loop]; name != "" {
+		return name
+	}
+	if b.added == nil {
+		b.added = make(map[string]bool)
+	}
+	name := "loop"
+	for i := 2; b.blocks.Label[name] != nil || b.added[name]; i++ {
+		name = fmt.Sprintf("loop%d", i)
+	}
+	b.added[name] = true
+	b.labels[loop] = name
+	b.edit.Insert(loop.Pos(), name+":\n")
+	return name
+}
+
+// after returns the statement following x, with any labels, in its list,
+// or nil if there is none.
+func (b *breaker) after(x ast.Stmt) ast.Stmt {
+	for {
+		l, ok := b.parent[x].(*ast.LabeledStmt)
+		if !ok {
+			break
+		}
+		x = l
+	}
+	list := grinder.BlockList(b.parent[x])
+	for i, y := range list {
+		if y == x && i+1 < len(list) {
+			return list[i+1]
+		}
+	}
+	return nil
+}
+
+func isEmpty(x ast.Stmt) bool {
+	_, ok := x.(*ast.EmptyStmt)
+	return ok
+}
@@ -0,0 +1,61 @@
+package p
+
+func find(x []int, v int) int {
+	i := 0
+	for i < len(x) {
+		if x[i] == v {
+			goto found
+		}
+		i++
+	}
+found:
+	return i
+}
+
+func search(m [][]int, v int) (int, int) {
+	var i, j int
+outer:
+	for i = 0; i < len(m); i++ {
+		for j = 0; j < len(m[i]); j++ {
+			if m[i][j] < 0 {
+				continue outer
+			}
+			if m[i][j] == v {
+				goto done
+			}
+		}
+	}
+done:
+	return i, j
+}
+
+func scan(c chan int, x []int) int {
+	n := 0
+	for _, v := range x {
+		switch {
+		case v < 0:
+			goto out
+		case v == 0:
+			goto next
+		}
+		n += v
+	next:
+	}
+out:
+	return n
+}
+
+func wait(c chan int) int {
+	n := 0
+	for {
+		select {
+		case v := <-c:
+			if v < 0 {
+				goto end
+			}
+			n += v
+		}
+	}
+end:
+	return n
+}
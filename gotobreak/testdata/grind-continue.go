@@ -0,0 +1,42 @@
+package p
+
+func sum(x []int) int {
+	n := 0
+	for i := 0; i < len(x); i++ {
+		if x[i] < 0 {
+			goto skip
+		}
+		n += x[i]
+	skip:
+	}
+	return n
+}
+
+func rows(m [][]int) int {
+	n := 0
+	for i := range m {
+		for _, v := range m[i] {
+			if v < 0 {
+				goto nextRow
+			}
+			n += v
+		}
+	nextRow:
+	}
+	return n
+}
+
+func poll(f func() int) int {
+	n := 0
+L1:
+	for {
+		v := f()
+		if v == 0 {
+			goto L1
+		}
+		if v < 0 {
+			return n
+		}
+		n += v
+	}
+}
@@ -0,0 +1,36 @@
+package p
+
+func first(x []int) int {
+	i := 0
+	for i < len(x) {
+		if x[i] > 0 {
+			goto found
+		}
+		i++
+	}
+	i = -1
+found:
+	return i
+}
+
+func restart(x []int) int {
+	n := 0
+L:
+	for i := 0; i < len(x); i++ {
+		if x[i] < 0 {
+			x[i] = 0
+			goto L
+		}
+		n += x[i]
+	}
+	return n
+}
+
+func lit(x []int) {
+	for range x {
+		func() {
+			goto end
+		end:
+		}()
+	}
+}
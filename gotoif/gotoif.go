@@ -0,0 +1,188 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package gotoif rewrites forward gotos that skip over statements
+// into if statements.
+package gotoif
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"rsc.io/grind/block"
+	"rsc.io/grind/grinder"
+)
+
+func Grind(ctxt *grinder.Context, pkg *grinder.Package) {
+	if pkg.TypesError != nil {
+		// Without type information, we can't negate conditions safely.
+		if ctxt.Verbose {
+			ctxt.Logf("%s: cannot rewrite gotos into if statements without type information", pkg.ImportPath)
+		}
+		return
+	}
+	grinder.GrindFuncDecls(ctxt, pkg, grindFunc)
+}
+
+func grindFunc(ctxt *grinder.Context, pkg *grinder.Package, edit *grinder.EditBuffer, fn *ast.FuncDecl) {
+	if fn.Body == nil {
+		return
+	}
+	r := &rewriter{pkg: pkg, edit: edit, blocks: block.Build(pkg.FileSet, fn.Body)}
+	ast.Inspect(fn.Body, func(x ast.Node) bool {
+		if r.done {
+			return false
+		}
+		// Work back from the end of the list, so that
+		// several gotos to one label nest: the last one first.
+		list := grinder.BlockList(x)
+		for i := len(list) - 1; i >= 0; i-- {
+			if r.rewrite(list, i) {
+				// The moved code might hold more, but those need
+				// new positions, so they wait for the next pass.
+				r.done = true
+				return false
+			}
+		}
+		return true
+	})
+}
+
+type rewriter struct {
+	pkg    *grinder.Package
+	edit   *grinder.EditBuffer
+	blocks *block.Graph
+	done   bool
+}
+
+// rewrite rewrites the goto in list[i], if it skips forward
+// over statements to a label later in list. It reports whether it made a change.
+//
+// The forms it recognizes are:
+//
+//	if c { goto L }; A; L:                →  if !c { A }; L:
+//	if c { goto L }; A; goto M; L: B; M:  →  if c { B } else { A }; M:
+func (r *rewriter) rewrite(list []ast.Stmt, i int) bool {
+	x, ok := list[i].(*ast.IfStmt)
+	if !ok || x.Init != nil || x.Else != nil || len(x.Body.List) != 1 {
+		return false
+	}
+	g, ok := x.Body.List[0].(*ast.BranchStmt)
+	if !ok || g.Tok != token.GOTO {
+		return false
+	}
+	j := index(list, g.Label.Name)
+	if j <= i+1 {
+		return false
+	}
+	edit := r.edit
+	text := func(start, end int) string {
+		return strings.TrimSpace(edit.TextAt(edit.AfterComment(edit.End(list[start-1])), edit.End(list[end-1])))
+	}
+
+	// if c { goto L }; A; goto M; L: B; M:
+	if m, ok := list[j-1].(*ast.BranchStmt); ok && m.Tok == token.GOTO && r.uses(list[j].(*ast.LabeledStmt).Label.Name) == 1 {
+		lstmt := list[j].(*ast.LabeledStmt)
+		k := index(list, m.Label.Name)
+		if k > j && r.canWrap(g, list, i+1, j-1, list[j]) && r.canWrap(g, list, j, k, list[k]) {
+			code := "if " + edit.TextAt(x.Cond.Pos(), x.Cond.End()) + " {\n" +
+				strings.TrimSpace(edit.TextAt(lstmt.Colon+1, edit.End(list[k-1]))) + "\n}"
+			if j-1 > i+1 {
+				code += " else {\n" + text(i+1, j-1) + "\n}"
+			}
+			edit.Replace(x.Pos(), edit.End(list[k-1]), code)
+			r.deleteLabel(list[k].(*ast.LabeledStmt))
+			return true
+		}
+	}
+
+	// if c { goto L }; A; L:
+	if !r.canWrap(g, list, i+1, j, list[j]) {
+		return false
+	}
+	edit.Replace(x.Pos(), edit.End(list[j-1]), "if "+grinder.Negate(r.pkg, edit, x.Cond)+" {\n"+text(i+1, j)+"\n}")
+	r.deleteLabel(list[j].(*ast.LabeledStmt))
+	return true
+}
+
+// index returns the index of the statement in list labeled name, or -1.
+func index(list []ast.Stmt, name string) int {
+	for i, x := range list {
+		if l, ok := x.(*ast.LabeledStmt); ok && l.Label.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// uses returns the number of branch statements naming the label.
+func (r *rewriter) uses(name string) int {
+	return len(r.blocks.Goto[name]) + len(r.blocks.Break[name]) + len(r.blocks.Continue[name])
+}
+
+// deleteLabel deletes the label x, whose only use the rewrite removed.
+func (r *rewriter) deleteLabel(x *ast.LabeledStmt) {
+	if r.uses(x.Label.Name) == 1 {
+		r.edit.DeleteLine(x.Pos(), x.Colon+1)
+	}
+}
+
+// canWrap reports whether list[start:end] can move into the body of
+// an if statement: no goto from outside enters it, other than g,
+// which the rewrite removes, and nothing from the statement after
+// on uses the names it declares.
+func (r *rewriter) canWrap(g *ast.BranchStmt, list []ast.Stmt, start, end int, after ast.Stmt) bool {
+	if start == end {
+		return true
+	}
+	lo, hi := list[start].Pos(), r.edit.End(list[end-1])
+	inside := func(x ast.Node) bool {
+		return lo <= x.Pos() && x.Pos() < hi
+	}
+	ok := true
+	declared := make(map[types.Object]bool)
+	for _, x := range list[start:end] {
+		ast.Inspect(x, func(y ast.Node) bool {
+			switch y := y.(type) {
+			case *ast.FuncLit:
+				return false // labels are local to the literal
+			case *ast.LabeledStmt:
+				for _, from := range r.blocks.Goto[y.Label.Name] {
+					if from != g && !inside(from) {
+						ok = false
+					}
+				}
+			}
+			return ok
+		})
+		switch x := grinder.Unlabel(x).(type) {
+		case *ast.AssignStmt:
+			if x.Tok == token.DEFINE {
+				for _, y := range x.Lhs {
+					if id, ok := y.(*ast.Ident); ok && r.pkg.Info.Defs[id] != nil {
+						declared[r.pkg.Info.Defs[id]] = true
+					}
+				}
+			}
+		case *ast.DeclStmt:
+			ast.Inspect(x, func(y ast.Node) bool {
+				if id, ok := y.(*ast.Ident); ok && r.pkg.Info.Defs[id] != nil {
+					declared[r.pkg.Info.Defs[id]] = true
+				}
+				return true
+			})
+		}
+	}
+	if !ok {
+		return false
+	}
+	for id, obj := range r.pkg.Info.Uses {
+		if declared[obj] && id.Pos() >= after.Pos() {
+			return false
+		}
+	}
+	return true
+}
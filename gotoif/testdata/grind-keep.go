@@ -0,0 +1,24 @@
+package p
+
+func entry(x int) int {
+	if x > 5 {
+		goto inside
+	}
+	if x < 0 {
+		goto done
+	}
+	x++
+inside:
+	x *= 2
+done:
+	return x
+}
+
+func backward(x int) int {
+loop:
+	x++
+	if x < 10 {
+		goto loop
+	}
+	return x
+}
@@ -0,0 +1,67 @@
+package p
+
+func f() int { return 1 }
+
+func g(int) {}
+
+func skip(x int) int {
+	if x < 0 {
+		goto done
+	}
+	x *= 2
+	g(x)
+done:
+	return x
+}
+
+func chain(x, y int) int {
+	n := 0
+	if x == 0 {
+		goto out
+	}
+	n += x
+	if y == 0 {
+		goto out
+	}
+	n += y
+out:
+	return n
+}
+
+func nested(list []float64) int {
+	n := 0
+	for _, v := range list {
+		if v > 1 {
+			goto next
+		}
+		n++
+	next:
+		g(n)
+	}
+	return n
+}
+
+func ifElse(x int) int {
+	var y int
+	if x > 10 {
+		goto big
+	}
+	y = x + 1
+	goto done
+big:
+	y = f()
+	g(y)
+done:
+	return y
+}
+
+func noElse(x int) int {
+	if x > 10 {
+		goto big
+	}
+	goto done
+big:
+	x = f()
+done:
+	return x
+}
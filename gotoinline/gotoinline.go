@@ -5,13 +5,11 @@
 package gotoinline
 
 import (
-	"fmt"
 	"go/ast"
 	"go/token"
+	"go/types"
 	"strings"
 
-	"golang.org/x/tools/go/types"
-
 	"rsc.io/grind/block"
 	"rsc.io/grind/grinder"
 )
@@ -22,6 +20,30 @@ func Grind(ctxt *grinder.Context, pkg *grinder.Package) {
 	grinder.GrindFuncDecls(ctxt, pkg, grindFunc)
 }
 
+// CountInlinable returns the number of goto statements in pkg
+// that Grind would replace with a copy of their target code.
+func CountInlinable(ctxt *grinder.Context, pkg *grinder.Package) int {
+	if pkg.TypesError != nil {
+		return 0
+	}
+	n := 0
+	grinder.GrindFuncDecls(ctxt, pkg, func(ctxt *grinder.Context, pkg *grinder.Package, edit *grinder.EditBuffer, fn *ast.FuncDecl) {
+		blocks := block.Build(pkg.FileSet, fn.Body)
+		for labelname, gotos := range blocks.Goto {
+			target, ok := inlineTarget(pkg, edit, fn, blocks, labelname, gotos)
+			if !ok {
+				continue
+			}
+			for _, g := range gotos {
+				if objsMatch(pkg, fn, g.Pos(), target.objs, target.start, target.end) {
+					n++
+				}
+			}
+		}
+	})
+	return n
+}
+
 type targetBlock struct {
 	comment    token.Pos
 	start      token.Pos
@@ -44,7 +66,7 @@ func grindFunc(ctxt *grinder.Context, pkg *grinder.Package, edit *grinder.EditBu
 
 	if pkg.TypesError != nil {
 		// Without scoping information, we can't be sure code moves are okay.
-		fmt.Printf("%s: cannot inline gotos without type information\n", fn.Name)
+		ctxt.Logf("%s: cannot inline gotos without type information", fn.Name)
 		return
 	}
 
@@ -53,11 +75,8 @@ func grindFunc(ctxt *grinder.Context, pkg *grinder.Package, edit *grinder.EditBu
 	}
 	blocks := block.Build(pkg.FileSet, fn.Body)
 	for labelname, gotos := range blocks.Goto {
-		target, ok := findTargetBlock(pkg, edit, fn, blocks, labelname)
-		if debug {
-			println("TARGET", ok, labelname, len(gotos), target.dead, target.short)
-		}
-		if ok && (len(gotos) == 1 && target.dead || target.short) {
+		target, ok := inlineTarget(pkg, edit, fn, blocks, labelname, gotos)
+		if ok {
 			numReplaced := 0
 			for _, g := range gotos {
 				code := edit.TextAt(target.comment, target.start) + target.code
@@ -96,6 +115,16 @@ func grindFunc(ctxt *grinder.Context, pkg *grinder.Package, edit *grinder.EditBu
 	}
 }
 
+// inlineTarget returns the target block of the gotos to labelname,
+// if it is suitable for inlining at the gotos.
+func inlineTarget(pkg *grinder.Package, edit *grinder.EditBuffer, fn *ast.FuncDecl, blocks *block.Graph, labelname string, gotos []*ast.BranchStmt) (target targetBlock, ok bool) {
+	target, ok = findTargetBlock(pkg, edit, fn, blocks, labelname)
+	if debug {
+		println("TARGET", ok, labelname, len(gotos), target.dead, target.short)
+	}
+	return target, ok && (len(gotos) == 1 && target.dead || target.short)
+}
+
 func findTargetBlock(pkg *grinder.Package, edit *grinder.EditBuffer, fn *ast.FuncDecl, blocks *block.Graph, labelname string) (target targetBlock, ok bool) {
 	if debug {
 		println("FINDTARGET", labelname)
@@ -0,0 +1,47 @@
+package p
+
+type Stack[T any] struct {
+	elems []T
+}
+
+func (s *Stack[T]) Pop() (T, bool) {
+	var zero T
+	if len(s.elems) == 0 {
+		goto empty
+	}
+	if cap(s.elems) == 0 {
+		goto empty
+	}
+	return s.pop(), true
+
+empty:
+	return zero, false
+}
+
+func (s *Stack[T]) pop() T
+
+func Find[K comparable, V any](m map[K]V, k K) V {
+	v, ok := m[k]
+	if !ok {
+		goto missing
+	}
+	return v
+
+missing:
+	println("missing", k)
+	return v
+}
+
+func Shadow[T any](x T) T {
+	{
+		x := 1
+		use(x)
+		goto ret
+	}
+	return x
+
+ret:
+	return x
+}
+
+func use(interface{})
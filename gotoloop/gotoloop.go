@@ -0,0 +1,248 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package gotoloop rewrites backward gotos into for loops.
+package gotoloop
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"rsc.io/grind/flow"
+	"rsc.io/grind/grinder"
+)
+
+func Grind(ctxt *grinder.Context, pkg *grinder.Package) {
+	if pkg.TypesError != nil {
+		// Without scoping information, we can't be sure code moves are okay.
+		if ctxt.Verbose {
+			ctxt.Logf("%s: cannot rewrite gotos into loops without type information", pkg.ImportPath)
+		}
+		return
+	}
+	grinder.GrindFuncDecls(ctxt, pkg, grindFunc)
+}
+
+func grindFunc(ctxt *grinder.Context, pkg *grinder.Package, edit *grinder.EditBuffer, fn *ast.FuncDecl) {
+	if fn.Body == nil {
+		return
+	}
+	g := flow.Build(pkg.FileSet, fn.Body, func(x ast.Node) bool {
+		_, ok := x.(ast.Stmt)
+		return ok
+	})
+	l := &looper{pkg: pkg, edit: edit}
+	l.walk(g, fn.Body)
+}
+
+type looper struct {
+	pkg  *grinder.Package
+	edit *grinder.EditBuffer
+	done bool
+}
+
+// walk looks for a loop to rewrite in body, whose flow graph is g.
+// It rewrites at most one: the code it moves might hold more,
+// but those need new positions, so they wait for the next pass.
+func (l *looper) walk(g *flow.Graph, body *ast.BlockStmt) {
+	ast.Inspect(body, func(x ast.Node) bool {
+		if l.done {
+			return false
+		}
+		switch x := x.(type) {
+		case *ast.FuncLit:
+			l.walk(g.Funcs[x], x.Body)
+			return false
+		case *ast.BlockStmt, *ast.CaseClause, *ast.CommClause:
+			list := grinder.BlockList(x)
+			for i := range list {
+				if l.rewrite(g, body, list, i) {
+					l.done = true
+					return false
+				}
+			}
+		}
+		return true
+	})
+}
+
+// rewrite rewrites the loop beginning at list[i], if there is one.
+// It reports whether it made a change.
+//
+// The loops it recognizes, in their goto forms, are:
+//
+//	L: S; if c { goto L }   →  for { S; if !c { break } }
+//	L: if c { S; goto L }   →  for c { S }
+//	L: S; goto L            →  for { S }
+func (l *looper) rewrite(g *flow.Graph, body *ast.BlockStmt, list []ast.Stmt, i int) bool {
+	lstmt, ok := list[i].(*ast.LabeledStmt)
+	if !ok {
+		return false
+	}
+	name := lstmt.Label.Name
+	edit := l.edit
+
+	// Find the goto that closes the loop.
+	var loopGoto *ast.BranchStmt
+	var cond ast.Expr // condition for another iteration; nil means always
+	var stmts []ast.Stmt
+	var code string
+	j := i
+	if x, ok := lstmt.Stmt.(*ast.IfStmt); ok && x.Init == nil && x.Else == nil && len(x.Body.List) > 0 && isGoto(x.Body.List[len(x.Body.List)-1], name) {
+		// L: if c { S; goto L }
+		loopGoto = x.Body.List[len(x.Body.List)-1].(*ast.BranchStmt)
+		stmts = x.Body.List[:len(x.Body.List)-1]
+		code = "for " + edit.TextAt(x.Cond.Pos(), x.Cond.End()) + " {" +
+			strings.TrimRight(edit.TextAt(x.Body.Lbrace+1, loopGoto.Pos()), " \t\n") +
+			edit.TextAt(loopGoto.End(), x.Body.Rbrace) + "}"
+	} else {
+		for j = i + 1; j < len(list); j++ {
+			if isGoto(list[j], name) {
+				// L: S; goto L
+				loopGoto = list[j].(*ast.BranchStmt)
+				break
+			}
+			if x, ok := list[j].(*ast.IfStmt); ok && x.Init == nil && x.Else == nil && len(x.Body.List) == 1 && isGoto(x.Body.List[0], name) {
+				// L: S; if c { goto L }
+				loopGoto = x.Body.List[0].(*ast.BranchStmt)
+				cond = x.Cond
+				break
+			}
+		}
+		if loopGoto == nil {
+			return false
+		}
+		stmts = append([]ast.Stmt{lstmt.Stmt}, list[i+1:j]...)
+		inner := strings.TrimSpace(edit.TextAt(lstmt.Colon+1, edit.End(list[j-1])))
+		if cond == nil {
+			code = "for {\n" + inner + "\n}"
+		} else {
+			code = "for {\n" + inner + "\nif " + grinder.Negate(l.pkg, edit, cond) + " {\nbreak\n}\n}"
+		}
+	}
+	start, end := lstmt.Pos(), edit.End(list[j])
+
+	if !singleEntry(g, lstmt, start, end) || !canWrap(l.pkg, stmts, end) || hasBranch(stmts, name) {
+		return false
+	}
+
+	// Keep the label if other gotos still use it.
+	others := false
+	ast.Inspect(body, func(x ast.Node) bool {
+		switch x := x.(type) {
+		case *ast.FuncLit:
+			return false // labels are local to the literal
+		case *ast.BranchStmt:
+			if x != loopGoto && isGoto(x, name) {
+				others = true
+			}
+		}
+		return !others
+	})
+	if others {
+		code = name + ":\n" + code
+	}
+	edit.Replace(start, end, code)
+	return true
+}
+
+func isGoto(x ast.Stmt, name string) bool {
+	b, ok := x.(*ast.BranchStmt)
+	return ok && b.Tok == token.GOTO && b.Label.Name == name
+}
+
+// singleEntry reports whether the only way into the code
+// from start to end, according to g, is through the label lstmt.
+func singleEntry(g *flow.Graph, lstmt *ast.LabeledStmt, start, end token.Pos) bool {
+	inside := func(x ast.Node) bool {
+		return start <= x.Pos() && x.Pos() < end
+	}
+	for x, preds := range g.Preds {
+		if x == lstmt || !inside(x) {
+			continue
+		}
+		for _, p := range preds {
+			if !inside(p) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// canWrap reports whether the statements can move into a loop body:
+// nothing after end uses the names they declare.
+func canWrap(pkg *grinder.Package, stmts []ast.Stmt, end token.Pos) bool {
+	declared := make(map[types.Object]bool)
+	for _, x := range stmts {
+		switch x := grinder.Unlabel(x).(type) {
+		case *ast.AssignStmt:
+			if x.Tok == token.DEFINE {
+				for _, y := range x.Lhs {
+					if id, ok := y.(*ast.Ident); ok && pkg.Info.Defs[id] != nil {
+						declared[pkg.Info.Defs[id]] = true
+					}
+				}
+			}
+		case *ast.DeclStmt:
+			ast.Inspect(x, func(y ast.Node) bool {
+				if id, ok := y.(*ast.Ident); ok && pkg.Info.Defs[id] != nil {
+					declared[pkg.Info.Defs[id]] = true
+				}
+				return true
+			})
+		}
+	}
+	if len(declared) == 0 {
+		return true
+	}
+	for id, obj := range pkg.Info.Uses {
+		if declared[obj] && id.Pos() >= end {
+			return false
+		}
+	}
+	return true
+}
+
+// hasBranch reports whether the statements contain a break or continue
+// that a new loop around them would capture, or a break or continue
+// naming the label, which the rewrite would redirect.
+func hasBranch(stmts []ast.Stmt, name string) bool {
+	found := false
+	var visit func(x ast.Node, breakOK, continueOK bool) bool
+	visit = func(x ast.Node, breakOK, continueOK bool) bool {
+		ast.Inspect(x, func(y ast.Node) bool {
+			if found || y == x {
+				return !found
+			}
+			switch y := y.(type) {
+			case *ast.FuncLit:
+				return false
+			case *ast.ForStmt, *ast.RangeStmt:
+				visit(y, true, true)
+				return false
+			case *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+				visit(y, true, continueOK)
+				return false
+			case *ast.BranchStmt:
+				switch y.Tok {
+				case token.BREAK:
+					found = y.Label == nil && !breakOK || y.Label != nil && y.Label.Name == name
+				case token.CONTINUE:
+					found = y.Label == nil && !continueOK || y.Label != nil && y.Label.Name == name
+				}
+			}
+			return !found
+		})
+		return found
+	}
+	for _, x := range stmts {
+		if visit(&ast.BlockStmt{List: []ast.Stmt{x}}, false, false) {
+			return true
+		}
+	}
+	return false
+}
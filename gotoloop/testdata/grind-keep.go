@@ -0,0 +1,49 @@
+package p
+
+func f() int { return 1 }
+
+func usedAfter(n int) int {
+loop:
+	x := f()
+	if x < n {
+		goto loop
+	}
+	return x
+}
+
+func breaks(list []int) {
+	for _, v := range list {
+	again:
+		if v > 10 {
+			break
+		}
+		v++
+		if v < 5 {
+			goto again
+		}
+	}
+}
+
+func twoEntries(n int) {
+	if n > 0 {
+		goto middle
+	}
+loop:
+	n++
+middle:
+	n++
+	if n < 10 {
+		goto loop
+	}
+}
+
+func extraGoto(n int) {
+loop:
+	n++
+	if n == 3 {
+		goto loop
+	}
+	if n < 10 {
+		goto loop
+	}
+}
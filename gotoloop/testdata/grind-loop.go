@@ -0,0 +1,74 @@
+package p
+
+func f() int { return 1 }
+
+func doWhile(n int) int {
+	i := 0
+	sum := 0
+loop:
+	sum += i
+	i++
+	if i < n {
+		goto loop
+	}
+	return sum
+}
+
+func while(n int) int {
+	i := 0
+again:
+	if i < n {
+		i += f()
+		goto again
+	}
+	return i
+}
+
+func forever(c chan int) {
+top:
+	v := <-c
+	if v == 0 {
+		return
+	}
+	println(v)
+	goto top
+}
+
+func negations(a, b int, x float64, ok bool) {
+L1:
+	a++
+	if !(a > b) {
+		goto L1
+	}
+L2:
+	b++
+	if ok {
+		goto L2
+	}
+L3:
+	x++
+	if x < 10 {
+		goto L3
+	}
+L4:
+	a++
+	if a > 0 && b > 0 {
+		goto L4
+	}
+}
+
+func nested(n int) int {
+	i := 0
+outer:
+	j := 0
+inner:
+	j++
+	if j < n {
+		goto inner
+	}
+	i++
+	if i < n {
+		goto outer
+	}
+	return i
+}
@@ -7,8 +7,7 @@ package grinder
 import (
 	"go/ast"
 	"go/token"
-
-	"golang.org/x/tools/go/types"
+	"go/types"
 
 	"rsc.io/grind/block"
 )
@@ -53,6 +52,12 @@ func IsTerminatingStmt(blocks *block.Graph, x ast.Stmt) bool {
 	switch x := x.(type) {
 	case *ast.ReturnStmt:
 		return true
+	case *ast.ExprStmt:
+		// A call to the built-in panic; the parser leaves it unresolved.
+		if call, ok := x.X.(*ast.CallExpr); ok {
+			id, ok := call.Fun.(*ast.Ident)
+			return ok && id.Name == "panic" && id.Obj == nil
+		}
 	case *ast.BranchStmt:
 		switch x.Tok {
 		case token.BREAK, token.CONTINUE, token.GOTO:
@@ -189,3 +194,48 @@ func BlockList(x ast.Node) []ast.Stmt {
 	}
 	return nil
 }
+
+// Negate returns the source text for the negation of the condition x.
+func Negate(pkg *Package, edit *EditBuffer, x ast.Expr) string {
+	text := func(x ast.Node) string {
+		return edit.TextAt(x.Pos(), x.End())
+	}
+	switch x := x.(type) {
+	case *ast.ParenExpr:
+		return Negate(pkg, edit, x.X)
+	case *ast.UnaryExpr:
+		if x.Op == token.NOT {
+			return text(x.X)
+		}
+	case *ast.BinaryExpr:
+		op := inverse[x.Op]
+		if op == token.ILLEGAL {
+			break
+		}
+		if x.Op != token.EQL && x.Op != token.NEQ && isFloat(pkg.Info.Types[x.X].Type) {
+			// Ordered comparisons of NaNs are all false.
+			break
+		}
+		return text(x.X) + " " + op.String() + " " + text(x.Y)
+	case *ast.Ident, *ast.CallExpr, *ast.SelectorExpr, *ast.IndexExpr:
+		return "!" + text(x)
+	}
+	return "!(" + text(x) + ")"
+}
+
+var inverse = map[token.Token]token.Token{
+	token.EQL: token.NEQ,
+	token.NEQ: token.EQL,
+	token.LSS: token.GEQ,
+	token.GEQ: token.LSS,
+	token.GTR: token.LEQ,
+	token.LEQ: token.GTR,
+}
+
+func isFloat(t types.Type) bool {
+	if t == nil {
+		return false
+	}
+	b, ok := t.Underlying().(*types.Basic)
+	return ok && b.Info()&(types.IsFloat|types.IsComplex) != 0
+}
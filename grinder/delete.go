@@ -0,0 +1,167 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package grinder
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+// Deletions records ranges of code to delete from a function,
+// accepting only deletions that leave the program compiling.
+type Deletions struct {
+	pkg      *Package
+	fn       *ast.FuncDecl
+	file     *ast.File
+	assigned map[*ast.Ident]bool
+	ranges   []posRange
+}
+
+type posRange struct {
+	start, end token.Pos
+}
+
+// NewDeletions returns an empty set of deletions from fn.
+func NewDeletions(pkg *Package, fn *ast.FuncDecl) *Deletions {
+	d := &Deletions{
+		pkg:      pkg,
+		fn:       fn,
+		assigned: make(map[*ast.Ident]bool),
+	}
+	for _, f := range pkg.Files {
+		if f.Pos() <= fn.Pos() && fn.Pos() < f.End() {
+			d.file = f
+		}
+	}
+
+	// Assigning to a variable does not use it.
+	ast.Inspect(fn.Body, func(x ast.Node) bool {
+		switch x := x.(type) {
+		case *ast.AssignStmt:
+			if x.Tok == token.ASSIGN || x.Tok == token.DEFINE {
+				for _, y := range x.Lhs {
+					if id, ok := unparen(y).(*ast.Ident); ok {
+						d.assigned[id] = true
+					}
+				}
+			}
+		case *ast.RangeStmt:
+			for _, y := range []ast.Expr{x.Key, x.Value} {
+				if id, ok := unparen(y).(*ast.Ident); ok {
+					d.assigned[id] = true
+				}
+			}
+		}
+		return true
+	})
+	return d
+}
+
+// Add adds the nodes to the deletions, unless deleting them
+// along with the code already added would break the program:
+// they hold the last use of a variable or imported package,
+// a declaration used by code that remains,
+// or a label targeted by a goto that remains.
+// Add reports whether the nodes were added; it adds all of them or none.
+func (d *Deletions) Add(nodes ...ast.Node) bool {
+	n := len(d.ranges)
+	for _, x := range nodes {
+		d.ranges = append(d.ranges, posRange{x.Pos(), x.End()})
+	}
+	if d.file == nil || !d.ok() {
+		d.ranges = d.ranges[:n]
+		return false
+	}
+	return true
+}
+
+// Deleted reports whether p is in code that has been added to the deletions.
+func (d *Deletions) Deleted(p token.Pos) bool {
+	for _, r := range d.ranges {
+		if r.start <= p && p < r.end {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Deletions) ok() bool {
+	body := d.fn.Body
+	inBody := func(p token.Pos) bool {
+		return body.Pos() <= p && p < body.End()
+	}
+
+	ok := true
+	uses := make(map[types.Object]int)
+	deadUses := make(map[types.Object]bool)
+	gotos := make(map[string]bool)
+	var labels []string
+	ast.Inspect(d.file, func(x ast.Node) bool {
+		switch x := x.(type) {
+		case *ast.Ident:
+			obj := d.pkg.Info.Uses[x]
+			if obj == nil {
+				break
+			}
+			if d.Deleted(x.Pos()) {
+				if !d.assigned[x] {
+					deadUses[obj] = true
+				}
+				break
+			}
+			if inBody(obj.Pos()) && d.Deleted(obj.Pos()) {
+				// Used outside the code that declares it.
+				ok = false
+			}
+			if !d.assigned[x] {
+				uses[obj]++
+			}
+		case *ast.BranchStmt:
+			if x.Tok == token.GOTO && inBody(x.Pos()) && !d.Deleted(x.Pos()) {
+				gotos[x.Label.Name] = true
+			}
+		case *ast.LabeledStmt:
+			if inBody(x.Pos()) && d.Deleted(x.Pos()) {
+				labels = append(labels, x.Label.Name)
+			}
+		}
+		return ok
+	})
+	if !ok {
+		return false
+	}
+
+	for obj := range deadUses {
+		if uses[obj] > 0 {
+			continue
+		}
+		switch obj := obj.(type) {
+		case *types.Var:
+			// A variable declared in the function and still declared after deletion.
+			if inBody(obj.Pos()) && !d.Deleted(obj.Pos()) {
+				return false
+			}
+		case *types.PkgName:
+			return false
+		}
+	}
+	for _, name := range labels {
+		if gotos[name] {
+			return false
+		}
+	}
+	return true
+}
+
+func unparen(x ast.Expr) ast.Expr {
+	for {
+		p, ok := x.(*ast.ParenExpr)
+		if !ok {
+			return x
+		}
+		x = p.X
+	}
+}
@@ -105,6 +105,23 @@ func (b *EditBuffer) BeforeComments(start token.Pos) token.Pos {
 	return start - token.Pos(b.tx(start)-lastNonBlank)
 }
 
+// AfterComment advances end past a line comment that follows it
+// on the same line and returns the result.
+func (b *EditBuffer) AfterComment(end token.Pos) token.Pos {
+	i := b.tx(end)
+	j := i
+	for j < len(b.text) && (b.text[j] == ' ' || b.text[j] == '\t') {
+		j++
+	}
+	if !strings.HasPrefix(b.text[j:], "//") {
+		return end
+	}
+	for j < len(b.text) && b.text[j] != '\n' {
+		j++
+	}
+	return end + token.Pos(j-i)
+}
+
 func (b *EditBuffer) TextAt(start, end token.Pos) string {
 	return string(b.text[b.tx(start):b.tx(end)])
 }
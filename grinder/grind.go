@@ -11,14 +11,17 @@ import (
 	"go/ast"
 	"go/build"
 	"go/format"
+	"go/importer"
 	"go/parser"
 	"go/token"
+	"go/types"
+	"io"
 	"io/ioutil"
+	"os"
 	"path/filepath"
+	"sort"
 	"strings"
-
-	_ "golang.org/x/tools/go/gcimporter"
-	"golang.org/x/tools/go/types"
+	"time"
 )
 
 type Package struct {
@@ -30,9 +33,10 @@ type Package struct {
 	TypesError error
 	Info       types.Info
 
-	clean  bool
-	oldSrc map[string]string
-	newSrc map[string]string
+	clean    bool
+	oldSrc   map[string]string
+	newSrc   map[string]string
+	selected map[string]map[string]bool // file name -> selected funcKeys; nil means all
 }
 
 func (p *Package) Src(name string) string {
@@ -69,6 +73,39 @@ type Context struct {
 	Logf     func(format string, args ...interface{})
 	Errors   bool
 	Grinders []Func
+
+	// Verbose causes the grinding passes and the edits
+	// they make to be reported using Logf.
+	Verbose bool
+
+	// Overlay maps file names to contents that should be used
+	// in place of the files on disk, in the same format as the
+	// Overlay field of golang.org/x/tools/go/packages.Config.
+	// File names may be absolute or relative to the current directory.
+	// An overlay entry for a file that does not exist on disk
+	// adds that file to its directory.
+	Overlay map[string][]byte
+
+	absOverlay map[string][]byte // Overlay keyed by absolute path
+
+	// Lines, if non-nil, restricts GrindFuncDecls to the function
+	// declarations overlapping the listed line ranges of each file.
+	// The map is keyed by file name, and the line numbers refer
+	// to the original source, before any rewrites.
+	// Files missing from the map are not ground at all.
+	Lines map[string][]LineRange
+
+	// Funcs, if non-nil, restricts GrindFuncDecls to the function
+	// declarations with the listed names. A name of the form "T.Name"
+	// selects the method Name of type T; a plain name selects both
+	// functions and methods with that name.
+	Funcs []string
+}
+
+// A LineRange is an inclusive range of line numbers.
+type LineRange struct {
+	Start int
+	End   int
 }
 
 func (ctxt *Context) Errorf(format string, args ...interface{}) {
@@ -84,8 +121,9 @@ func (ctxt *Context) GrindFiles(files ...string) *Package {
 		newSrc:     make(map[string]string),
 	}
 
+	ctxt.loadOverlay()
 	for _, file := range files {
-		data, err := ioutil.ReadFile(file)
+		data, err := ctxt.readFile(file)
 		if err != nil {
 			ctxt.Errorf("%v", err)
 			return nil
@@ -98,10 +136,23 @@ func (ctxt *Context) GrindFiles(files ...string) *Package {
 	return pkg
 }
 
+// GrindPackage grinds the package with the given import path.
+// The path may also be a relative or absolute directory name.
 func (ctxt *Context) GrindPackage(path string) *Package {
+	ctxt.loadOverlay()
 	buildCtxt := build.Default
+	if len(ctxt.absOverlay) > 0 {
+		buildCtxt.OpenFile = ctxt.openFile
+		buildCtxt.ReadDir = ctxt.readDir
+	}
 
-	buildPkg, err := buildCtxt.Import(path, ".", 0)
+	var buildPkg *build.Package
+	var err error
+	if filepath.IsAbs(path) {
+		buildPkg, err = buildCtxt.ImportDir(path, 0)
+	} else {
+		buildPkg, err = buildCtxt.Import(path, ".", 0)
+	}
 	if err != nil {
 		ctxt.Errorf("%v", err)
 		return nil
@@ -120,7 +171,7 @@ func (ctxt *Context) GrindPackage(path string) *Package {
 	for _, name := range buildPkg.GoFiles {
 		filename := filepath.Join(buildPkg.Dir, name)
 		pkg.Filenames = append(pkg.Filenames, filename)
-		data, err := ioutil.ReadFile(filename)
+		data, err := ctxt.readFile(filename)
 		if err != nil {
 			ctxt.Errorf("%s: %v", path, err)
 			return nil
@@ -133,10 +184,105 @@ func (ctxt *Context) GrindPackage(path string) *Package {
 	return pkg
 }
 
+// loadOverlay records the Overlay entries by absolute path,
+// so that lookups need not convert every entry.
+func (ctxt *Context) loadOverlay() {
+	ctxt.absOverlay = nil
+	for file, data := range ctxt.Overlay {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			continue
+		}
+		if ctxt.absOverlay == nil {
+			ctxt.absOverlay = make(map[string][]byte)
+		}
+		ctxt.absOverlay[abs] = data
+	}
+}
+
+// overlay returns the overlay contents for the named file, if any.
+func (ctxt *Context) overlay(name string) ([]byte, bool) {
+	if len(ctxt.absOverlay) == 0 {
+		return nil, false
+	}
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return nil, false
+	}
+	data, ok := ctxt.absOverlay[abs]
+	return data, ok
+}
+
+func (ctxt *Context) readFile(name string) ([]byte, error) {
+	if data, ok := ctxt.overlay(name); ok {
+		return data, nil
+	}
+	return ioutil.ReadFile(name)
+}
+
+func (ctxt *Context) openFile(name string) (io.ReadCloser, error) {
+	if data, ok := ctxt.overlay(name); ok {
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+	return os.Open(name)
+}
+
+// readDir is like ioutil.ReadDir but adds files that
+// exist only in the overlay.
+func (ctxt *Context) readDir(dir string) ([]os.FileInfo, error) {
+	list, readErr := ioutil.ReadDir(dir)
+	if readErr != nil && !os.IsNotExist(readErr) {
+		return nil, readErr
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	have := make(map[string]bool)
+	for _, fi := range list {
+		have[fi.Name()] = true
+	}
+	added := false
+	for abs, data := range ctxt.absOverlay {
+		if filepath.Dir(abs) != absDir || have[filepath.Base(abs)] {
+			continue
+		}
+		have[filepath.Base(abs)] = true
+		list = append(list, overlayInfo{filepath.Base(abs), int64(len(data))})
+		added = true
+	}
+	if readErr != nil && !added {
+		return nil, readErr
+	}
+	sort.Sort(byName(list))
+	return list, nil
+}
+
+// overlayInfo is the os.FileInfo for a file that exists only in the overlay.
+type overlayInfo struct {
+	name string
+	size int64
+}
+
+func (fi overlayInfo) Name() string       { return fi.name }
+func (fi overlayInfo) Size() int64        { return fi.size }
+func (fi overlayInfo) Mode() os.FileMode  { return 0444 }
+func (fi overlayInfo) ModTime() time.Time { return time.Time{} }
+func (fi overlayInfo) IsDir() bool        { return false }
+func (fi overlayInfo) Sys() interface{}   { return nil }
+
+type byName []os.FileInfo
+
+func (x byName) Len() int           { return len(x) }
+func (x byName) Swap(i, j int)      { x[i], x[j] = x[j], x[i] }
+func (x byName) Less(i, j int) bool { return x[i].Name() < x[j].Name() }
+
 func (ctxt *Context) grind(pkg *Package) {
 Loop:
 	for loop := 0; ; loop++ {
-		println(loop)
+		if ctxt.Verbose {
+			ctxt.Logf("%s: pass %d", pkg.ImportPath, loop)
+		}
 		pkg.FileSet = token.NewFileSet()
 
 		pkg.Files = nil
@@ -152,14 +298,21 @@ Loop:
 			}
 			pkg.Files = append(pkg.Files, f)
 		}
+		if loop == 0 {
+			ctxt.selectFuncs(pkg)
+		}
 
-		conf := new(types.Config)
+		// Import from source, so that packages need not be installed.
+		conf := &types.Config{Importer: importer.ForCompiler(pkg.FileSet, "source", nil)}
 		// conf.DisableUnusedImportCheck = true
 		pkg.Info = types.Info{}
 		pkg.Info.Types = make(map[ast.Expr]types.TypeAndValue)
 		pkg.Info.Scopes = make(map[ast.Node]*types.Scope)
 		pkg.Info.Defs = make(map[*ast.Ident]types.Object)
 		pkg.Info.Uses = make(map[*ast.Ident]types.Object)
+		pkg.Info.Selections = make(map[*ast.SelectorExpr]*types.Selection)
+		pkg.Info.Implicits = make(map[ast.Node]types.Object)
+		pkg.Info.Instances = make(map[*ast.Ident]types.Instance)
 		typesPkg, err := conf.Check(pkg.ImportPath, pkg.FileSet, pkg.Files, &pkg.Info)
 		if err != nil && typesPkg == nil {
 			if loop > 0 {
@@ -196,12 +349,11 @@ func GrindFuncDecls(ctxt *Context, pkg *Package, fn func(ctxt *Context, pkg *Pac
 			continue
 		}
 		edit := NewEditBuffer(pkg, filename, file)
-		for _, decl := range file.Decls {
-			decl, ok := decl.(*ast.FuncDecl)
-			if !ok || decl.Body == nil {
+		for _, decl := range funcDecls(file) {
+			if !pkg.isSelected(filename, decl.key) {
 				continue
 			}
-			fn(ctxt, pkg, edit, decl)
+			fn(ctxt, pkg, edit, decl.fn)
 		}
 		if edit.NumEdits() > 0 {
 			old := pkg.Src(filename)
@@ -211,9 +363,118 @@ func GrindFuncDecls(ctxt *Context, pkg *Package, fn func(ctxt *Context, pkg *Pac
 				// but sometimes we delete a var declaration only to
 				// put it right back where we started.
 				// Hopefully there are no cycles. Ugh.
-				fmt.Printf("EDIT: %s\n%s\n", filename, Diff(old, new))
+				if ctxt.Verbose {
+					ctxt.Logf("EDIT: %s\n%s", filename, Diff(old, new))
+				}
 				pkg.Rewrite(filename, new)
 			}
 		}
 	}
 }
+
+type funcDecl struct {
+	fn  *ast.FuncDecl
+	key string
+}
+
+// funcDecls returns the function declarations with bodies in f,
+// along with keys identifying them that survive rewrites of the file.
+func funcDecls(f *ast.File) []funcDecl {
+	var list []funcDecl
+	seen := make(map[string]int)
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+		name := FuncName(fn)
+		seen[name]++
+		list = append(list, funcDecl{fn, fmt.Sprintf("%s#%d", name, seen[name])})
+	}
+	return list
+}
+
+// FuncName returns the name of fn, qualified by the receiver
+// type name for methods, as in "T.Method".
+func FuncName(fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return fn.Name.Name
+	}
+	typ := fn.Recv.List[0].Type
+	for {
+		switch t := typ.(type) {
+		case *ast.StarExpr:
+			typ = t.X
+			continue
+		case *ast.ParenExpr:
+			typ = t.X
+			continue
+		case *ast.IndexExpr:
+			typ = t.X
+			continue
+		case *ast.Ident:
+			return t.Name + "." + fn.Name.Name
+		}
+		return fn.Name.Name
+	}
+}
+
+// selectFuncs records which function declarations in the
+// freshly parsed original source satisfy ctxt.Lines and ctxt.Funcs.
+func (ctxt *Context) selectFuncs(pkg *Package) {
+	pkg.selected = nil
+	if ctxt.Lines == nil && ctxt.Funcs == nil {
+		return
+	}
+	lines := make(map[string][]LineRange)
+	for name, list := range ctxt.Lines {
+		lines[absPath(name)] = append(lines[absPath(name)], list...)
+	}
+	pkg.selected = make(map[string]map[string]bool)
+	for i, filename := range pkg.Filenames {
+		sel := make(map[string]bool)
+		pkg.selected[filename] = sel
+		ranges := lines[absPath(filename)]
+		for _, decl := range funcDecls(pkg.Files[i]) {
+			if ctxt.Lines != nil && !overlaps(pkg.FileSet, decl.fn, ranges) {
+				continue
+			}
+			if ctxt.Funcs != nil && !nameMatches(decl.fn, ctxt.Funcs) {
+				continue
+			}
+			sel[decl.key] = true
+		}
+	}
+}
+
+func overlaps(fset *token.FileSet, fn *ast.FuncDecl, ranges []LineRange) bool {
+	start := fset.Position(fn.Pos()).Line
+	end := fset.Position(fn.End()).Line
+	for _, r := range ranges {
+		if r.Start <= end && start <= r.End {
+			return true
+		}
+	}
+	return false
+}
+
+func nameMatches(fn *ast.FuncDecl, names []string) bool {
+	full := FuncName(fn)
+	for _, name := range names {
+		if name == full || name == fn.Name.Name {
+			return true
+		}
+	}
+	return false
+}
+
+func (pkg *Package) isSelected(filename, key string) bool {
+	return pkg.selected == nil || pkg.selected[filename][key]
+}
+
+func absPath(name string) string {
+	if abs, err := filepath.Abs(name); err == nil {
+		return abs
+	}
+	return name
+}
@@ -0,0 +1,131 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package grinder
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func testContext(buf *bytes.Buffer) *Context {
+	return &Context{
+		Logf: func(format string, args ...interface{}) {
+			fmt.Fprintf(buf, format+"\n", args...)
+		},
+	}
+}
+
+func TestOverlayFiles(t *testing.T) {
+	var buf bytes.Buffer
+	ctxt := testContext(&buf)
+	file := filepath.Join("testdata", "overlay", "a.go")
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const src = "package overlay\n\nfunc f() int {\n\treturn 2\n}\n"
+	ctxt.Overlay = map[string][]byte{abs: []byte(src)}
+	pkg := ctxt.GrindFiles(file)
+	if pkg == nil || ctxt.Errors {
+		t.Fatalf("grind failed:\n%s", buf.String())
+	}
+	if have := pkg.OrigSrc(file); have != src {
+		t.Errorf("OrigSrc = %q, want overlay %q", have, src)
+	}
+}
+
+func TestOverlayPackage(t *testing.T) {
+	var buf bytes.Buffer
+	ctxt := testContext(&buf)
+	const srcA = "package overlay\n\nfunc f() int {\n\treturn g()\n}\n"
+	const srcB = "package overlay\n\nfunc g() int {\n\treturn 3\n}\n"
+	ctxt.Overlay = map[string][]byte{
+		filepath.Join("testdata", "overlay", "a.go"): []byte(srcA),
+		filepath.Join("testdata", "overlay", "b.go"): []byte(srcB), // not on disk
+	}
+	pkg := ctxt.GrindPackage("./testdata/overlay")
+	if pkg == nil || ctxt.Errors {
+		t.Fatalf("grind failed:\n%s", buf.String())
+	}
+	if len(pkg.Filenames) != 2 {
+		t.Fatalf("Filenames = %v, want a.go and b.go", pkg.Filenames)
+	}
+	for i, want := range []string{srcA, srcB} {
+		if have := pkg.OrigSrc(pkg.Filenames[i]); have != want {
+			t.Errorf("OrigSrc(%s) = %q, want %q", pkg.Filenames[i], have, want)
+		}
+	}
+}
+
+func TestOverlayEmptyDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grinder-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ctxt := &Context{Overlay: map[string][]byte{filepath.Join("testdata", "overlay", "b.go"): []byte("package overlay\n")}}
+	ctxt.loadOverlay()
+	list, err := ctxt.readDir(dir)
+	if err != nil || len(list) != 0 {
+		t.Errorf("readDir(empty dir) = %v, %v, want empty list and no error", list, err)
+	}
+}
+
+func TestLines(t *testing.T) {
+	file := filepath.Join("testdata", "lines", "a.go")
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	var visited []string
+	ctxt := testContext(&buf)
+	ctxt.Lines = map[string][]LineRange{abs: {{10, 10}, {15, 20}}}
+	ctxt.Grinders = []Func{func(ctxt *Context, pkg *Package) {
+		GrindFuncDecls(ctxt, pkg, func(ctxt *Context, pkg *Package, edit *EditBuffer, fn *ast.FuncDecl) {
+			visited = append(visited, FuncName(fn))
+		})
+	}}
+	if pkg := ctxt.GrindFiles(file); pkg == nil || ctxt.Errors {
+		t.Fatalf("grind failed:\n%s", buf.String())
+	}
+	if want := []string{"T.f", "g"}; !reflect.DeepEqual(visited, want) {
+		t.Errorf("visited %v, want %v", visited, want)
+	}
+}
+
+func TestFuncs(t *testing.T) {
+	var buf bytes.Buffer
+	ctxt := testContext(&buf)
+	var visited []string
+	ctxt.Grinders = []Func{func(ctxt *Context, pkg *Package) {
+		GrindFuncDecls(ctxt, pkg, func(ctxt *Context, pkg *Package, edit *EditBuffer, fn *ast.FuncDecl) {
+			visited = append(visited, FuncName(fn))
+		})
+	}}
+	for _, tt := range []struct {
+		funcs []string
+		want  []string
+	}{
+		{[]string{"f"}, []string{"f", "T.f"}},
+		{[]string{"T.f"}, []string{"T.f"}},
+		{[]string{"g", "h"}, []string{"g"}},
+	} {
+		visited = nil
+		ctxt.Funcs = tt.funcs
+		if pkg := ctxt.GrindFiles(filepath.Join("testdata", "lines", "a.go")); pkg == nil || ctxt.Errors {
+			t.Fatalf("grind failed:\n%s", buf.String())
+		}
+		if !reflect.DeepEqual(visited, tt.want) {
+			t.Errorf("Funcs=%v: visited %v, want %v", tt.funcs, visited, tt.want)
+		}
+	}
+}
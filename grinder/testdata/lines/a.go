@@ -0,0 +1,15 @@
+package lines
+
+func f() {
+	println("f")
+}
+
+type T int
+
+func (t *T) f() {
+	println("T.f")
+}
+
+func g() {
+	println("g")
+}
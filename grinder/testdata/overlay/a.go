@@ -0,0 +1,5 @@
+package overlay
+
+func f() int {
+	return 1
+}
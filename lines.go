@@ -0,0 +1,63 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"rsc.io/grind/grinder"
+)
+
+// A linesFlag is a repeatable -lines flag of the form file.go:start-end or file.go:line.
+type linesFlag map[string][]grinder.LineRange
+
+func (f linesFlag) String() string {
+	var list []string
+	for file, ranges := range f {
+		for _, r := range ranges {
+			list = append(list, fmt.Sprintf("%s:%d-%d", file, r.Start, r.End))
+		}
+	}
+	return strings.Join(list, ",")
+}
+
+func (f linesFlag) Set(s string) error {
+	i := strings.LastIndex(s, ":")
+	if i < 0 {
+		return fmt.Errorf("missing line range in %q", s)
+	}
+	file, spec := s[:i], s[i+1:]
+	var r grinder.LineRange
+	var err1, err2 error
+	if j := strings.Index(spec, "-"); j >= 0 {
+		r.Start, err1 = strconv.Atoi(spec[:j])
+		r.End, err2 = strconv.Atoi(spec[j+1:])
+	} else {
+		r.Start, err1 = strconv.Atoi(spec)
+		r.End = r.Start
+	}
+	if file == "" || err1 != nil || err2 != nil || r.Start < 1 || r.End < r.Start {
+		return fmt.Errorf("invalid line range %q", s)
+	}
+	f[file] = append(f[file], r)
+	return nil
+}
+
+// A funcsFlag is a repeatable -func flag naming a function or method (T.Name).
+type funcsFlag []string
+
+func (f *funcsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *funcsFlag) Set(s string) error {
+	if s == "" {
+		return fmt.Errorf("empty function name")
+	}
+	*f = append(*f, s)
+	return nil
+}
@@ -0,0 +1,31 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLinesFlag(t *testing.T) {
+	f := linesFlag{}
+	for _, s := range []string{"a.go:120-300", "a.go:7", "b/c.go:1-1"} {
+		if err := f.Set(s); err != nil {
+			t.Errorf("Set(%q): %v", s, err)
+		}
+	}
+	want := linesFlag{
+		"a.go":   {{Start: 120, End: 300}, {Start: 7, End: 7}},
+		"b/c.go": {{Start: 1, End: 1}},
+	}
+	if !reflect.DeepEqual(f, want) {
+		t.Errorf("lines = %v, want %v", f, want)
+	}
+	for _, s := range []string{"a.go", "a.go:", ":1", "a.go:x", "a.go:5-3", "a.go:0"} {
+		if err := f.Set(s); err == nil {
+			t.Errorf("Set(%q) succeeded, want error", s)
+		}
+	}
+}
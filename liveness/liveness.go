@@ -0,0 +1,407 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package liveness computes which local variables are live
+// at each point in a function body.
+//
+// A variable is live at a point if its current value may be read
+// later along some path through the function. A variable whose address
+// is taken or that is shared with a closure may be read at any time,
+// so liveness treats such variables as live everywhere.
+package liveness
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"rsc.io/grind/flow"
+)
+
+// Info holds the result of liveness analysis for a function body.
+//
+// The analysis runs over a flow graph whose nodes are the identifiers
+// referring to tracked variables, var declarations, and block statements.
+// The live-in set of a block statement gives the variables live on entry
+// to the block, so for a loop l, info.LiveIn(l.Body, v) reports whether
+// v may be read in the loop before being assigned.
+type Info struct {
+	Graph *flow.Graph
+	Vars  []*types.Var // tracked variables, in declaration order
+
+	index  map[*types.Var]int
+	always bitset // variables live everywhere
+	in     map[ast.Node]bitset
+	out    map[ast.Node]bitset
+	gen    map[ast.Node]bitset
+	kill   map[ast.Node]bitset
+}
+
+// Compute computes liveness for fn, which must be an *ast.FuncDecl
+// with a body or an *ast.FuncLit. Info must hold the Defs, Uses, Types,
+// and Selections recorded by type-checking the function.
+// Variables declared outside fn, including those a function literal
+// shares with its enclosing function, are not tracked.
+func Compute(fset *token.FileSet, info *types.Info, fn ast.Node) *Info {
+	var typ *ast.FuncType
+	var body *ast.BlockStmt
+	var recv *ast.FieldList
+	switch fn := fn.(type) {
+	case *ast.FuncDecl:
+		typ, body, recv = fn.Type, fn.Body, fn.Recv
+	case *ast.FuncLit:
+		typ, body = fn.Type, fn.Body
+	default:
+		panic("liveness: Compute of non-function")
+	}
+
+	l := &Info{
+		index: make(map[*types.Var]int),
+		gen:   make(map[ast.Node]bitset),
+		kill:  make(map[ast.Node]bitset),
+	}
+
+	// Find the variables declared in the function, outside closures.
+	addVar := func(id *ast.Ident) {
+		if v, ok := info.Defs[id].(*types.Var); ok && !v.IsField() {
+			if _, ok := l.index[v]; !ok {
+				l.index[v] = len(l.Vars)
+				l.Vars = append(l.Vars, v)
+			}
+		}
+	}
+	for _, list := range []*ast.FieldList{recv, typ.Params, typ.Results} {
+		if list == nil {
+			continue
+		}
+		for _, field := range list.List {
+			for _, id := range field.Names {
+				addVar(id)
+			}
+		}
+	}
+	ast.Inspect(body, func(x ast.Node) bool {
+		switch x := x.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.Ident:
+			addVar(x)
+		}
+		return true
+	})
+	l.always = newBitset(len(l.Vars))
+
+	// Find the identifiers that assign to variables
+	// and the variables that may be accessed indirectly.
+	assigned := make(map[*ast.Ident]bool)
+	ast.Inspect(body, func(x ast.Node) bool {
+		switch x := x.(type) {
+		case *ast.AssignStmt:
+			if x.Tok == token.ASSIGN || x.Tok == token.DEFINE {
+				for _, y := range x.Lhs {
+					if id, ok := unparen(y).(*ast.Ident); ok {
+						assigned[id] = true
+					}
+				}
+			}
+		case *ast.RangeStmt:
+			for _, y := range []ast.Expr{x.Key, x.Value} {
+				if id, ok := unparen(y).(*ast.Ident); ok {
+					assigned[id] = true
+				}
+			}
+		case *ast.UnaryExpr:
+			if x.Op == token.AND {
+				l.escape(info, x.X)
+			}
+		case *ast.SliceExpr:
+			if tv, ok := info.Types[x.X]; ok && tv.Type != nil {
+				if _, ok := tv.Type.Underlying().(*types.Array); ok {
+					l.escape(info, x.X)
+				}
+			}
+		case *ast.SelectorExpr:
+			// Calling a pointer method on an addressable value takes its address.
+			if sel, ok := info.Selections[x]; ok && sel.Kind() == types.MethodVal {
+				if fn, ok := sel.Obj().(*types.Func); ok {
+					recv := fn.Type().(*types.Signature).Recv()
+					if _, ptrRecv := recv.Type().Underlying().(*types.Pointer); ptrRecv && !isPointer(sel.Recv()) {
+						l.escape(info, x.X)
+					}
+				}
+			}
+		case *ast.FuncLit:
+			ast.Inspect(x.Body, func(y ast.Node) bool {
+				if id, ok := y.(*ast.Ident); ok {
+					if v, ok := info.Uses[id].(*types.Var); ok {
+						if i, ok := l.index[v]; ok {
+							l.always.set(i)
+						}
+					}
+				}
+				return true
+			})
+			return false
+		}
+		return true
+	})
+
+	// Build flow graph and per-node effects.
+	l.Graph = flow.Build(fset, body, func(x ast.Node) bool {
+		switch x := x.(type) {
+		case *ast.BlockStmt, *ast.DeclStmt:
+			return true
+		case *ast.Ident:
+			return l.varOf(info, x) >= 0
+		}
+		return false
+	})
+	n := len(l.Vars)
+	for x := range l.Graph.Preds {
+		gen, kill := newBitset(n), newBitset(n)
+		switch x := x.(type) {
+		case *ast.Ident:
+			i := l.varOf(info, x)
+			if i < 0 {
+				break
+			}
+			if assigned[x] {
+				kill.set(i)
+			} else {
+				gen.set(i)
+			}
+		case *ast.DeclStmt:
+			// The flow graph does not descend into declarations,
+			// so account for the initializers here.
+			for _, spec := range x.Decl.(*ast.GenDecl).Specs {
+				spec, ok := spec.(*ast.ValueSpec)
+				if !ok {
+					continue
+				}
+				for _, id := range spec.Names {
+					if i := l.varOf(info, id); i >= 0 {
+						kill.set(i)
+					}
+				}
+				for _, v := range spec.Values {
+					ast.Inspect(v, func(y ast.Node) bool {
+						if _, ok := y.(*ast.FuncLit); ok {
+							return false
+						}
+						if id, ok := y.(*ast.Ident); ok {
+							if i := l.varOf(info, id); i >= 0 {
+								gen.set(i)
+							}
+						}
+						return true
+					})
+				}
+			}
+		}
+		l.gen[x] = gen
+		l.kill[x] = kill
+	}
+
+	// Named results are read by the return at End.
+	end := newBitset(n)
+	if typ.Results != nil {
+		for _, field := range typ.Results.List {
+			for _, id := range field.Names {
+				if i := l.varOf(info, id); i >= 0 {
+					end.set(i)
+				}
+			}
+		}
+	}
+	l.gen[l.Graph.End] = end
+	l.kill[l.Graph.End] = newBitset(n)
+
+	a := &flow.Analysis[bitset]{
+		Lattice:  lattice(n),
+		Transfer: l.transfer,
+		Entry:    newBitset(n),
+		Backward: true,
+	}
+	facts, _ := a.Run(l.Graph)
+	l.in, l.out = facts.In, facts.Out
+	for _, s := range l.in {
+		s.or(l.always)
+	}
+	for _, s := range l.out {
+		s.or(l.always)
+	}
+	return l
+}
+
+// varOf returns the index of the tracked variable id refers to, or -1.
+func (l *Info) varOf(info *types.Info, id *ast.Ident) int {
+	obj := info.Defs[id]
+	if obj == nil {
+		obj = info.Uses[id]
+	}
+	if v, ok := obj.(*types.Var); ok {
+		if i, ok := l.index[v]; ok {
+			return i
+		}
+	}
+	return -1
+}
+
+// escape records that the variable at the root of x may be accessed indirectly.
+func (l *Info) escape(info *types.Info, x ast.Expr) {
+	for {
+		switch y := x.(type) {
+		case *ast.ParenExpr:
+			x = y.X
+			continue
+		case *ast.SelectorExpr:
+			if sel, ok := info.Selections[y]; ok && sel.Kind() == types.FieldVal && !isPointer(sel.Recv()) {
+				x = y.X
+				continue
+			}
+		case *ast.IndexExpr:
+			if tv, ok := info.Types[y.X]; ok && tv.Type != nil {
+				if _, ok := tv.Type.Underlying().(*types.Array); ok {
+					x = y.X
+					continue
+				}
+			}
+		case *ast.Ident:
+			if i := l.varOf(info, y); i >= 0 {
+				l.always.set(i)
+			}
+		}
+		return
+	}
+}
+
+func isPointer(t types.Type) bool {
+	_, ok := t.Underlying().(*types.Pointer)
+	return ok
+}
+
+func unparen(x ast.Expr) ast.Expr {
+	for {
+		p, ok := x.(*ast.ParenExpr)
+		if !ok {
+			return x
+		}
+		x = p.X
+	}
+}
+
+// transfer returns the variables live before x given those live after it.
+func (l *Info) transfer(x ast.Node, out bitset) bitset {
+	in := out.copy()
+	if kill := l.kill[x]; kill != nil {
+		in.andNot(kill)
+	}
+	if gen := l.gen[x]; gen != nil {
+		in.or(gen)
+	}
+	return in
+}
+
+// A lattice is the lattice of sets of n variables.
+type lattice int
+
+func (n lattice) Bottom() bitset { return newBitset(int(n)) }
+
+func (lattice) Join(s, t bitset) bitset {
+	u := s.copy()
+	u.or(t)
+	return u
+}
+
+func (lattice) Equal(s, t bitset) bool {
+	for i := range s {
+		if s[i] != t[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// IsLiveIn reports whether v may be live on entry to x.
+// If x is not a node of the flow graph, or v is not a variable
+// declared in the function, IsLiveIn conservatively reports true.
+// Nodes from which the function cannot return, such as
+// those in an infinite loop, are also treated as unknown.
+func (l *Info) IsLiveIn(x ast.Node, v *types.Var) bool {
+	return l.isLive(l.in, x, v)
+}
+
+// IsLiveOut reports whether v may be live on exit from x.
+// It answers conservatively in the same cases as IsLiveIn.
+func (l *Info) IsLiveOut(x ast.Node, v *types.Var) bool {
+	return l.isLive(l.out, x, v)
+}
+
+func (l *Info) isLive(m map[ast.Node]bitset, x ast.Node, v *types.Var) bool {
+	i, ok := l.index[v]
+	s, ok2 := m[x]
+	if !ok || !ok2 {
+		return true
+	}
+	return s.has(i)
+}
+
+// LiveIn returns the variables live on entry to x, in declaration order.
+// It returns nil if x is not a node of the flow graph.
+func (l *Info) LiveIn(x ast.Node) []*types.Var {
+	return l.vars(l.in[x])
+}
+
+// LiveOut returns the variables live on exit from x, in declaration order.
+// It returns nil if x is not a node of the flow graph.
+func (l *Info) LiveOut(x ast.Node) []*types.Var {
+	return l.vars(l.out[x])
+}
+
+func (l *Info) vars(s bitset) []*types.Var {
+	var list []*types.Var
+	for i, v := range l.Vars {
+		if s.has(i) {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// A bitset is a set of variable indexes.
+type bitset []uint64
+
+func newBitset(n int) bitset {
+	return make(bitset, (n+63)/64)
+}
+
+func (s bitset) has(i int) bool {
+	return i/64 < len(s) && s[i/64]&(1<<uint(i%64)) != 0
+}
+
+func (s bitset) set(i int) {
+	s[i/64] |= 1 << uint(i%64)
+}
+
+func (s bitset) copy() bitset {
+	return append(bitset(nil), s...)
+}
+
+func (s bitset) andNot(t bitset) {
+	for i := range s {
+		s[i] &^= t[i]
+	}
+}
+
+// or sets s to s ∪ t and reports whether s changed.
+func (s bitset) or(t bitset) bool {
+	changed := false
+	for i := range s {
+		if s[i]|t[i] != s[i] {
+			s[i] |= t[i]
+			changed = true
+		}
+	}
+	return changed
+}
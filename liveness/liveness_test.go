@@ -0,0 +1,94 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package liveness
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/types"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"rsc.io/grind/grinder"
+)
+
+func TestGolden(t *testing.T) {
+	matches, err := filepath.Glob("testdata/live-*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) == 0 {
+		t.Fatal("no testdata found")
+	}
+	for _, file := range matches {
+		var buf bytes.Buffer
+		ctxt := &grinder.Context{
+			Logf: func(format string, args ...interface{}) {
+				fmt.Fprintf(&buf, format+"\n", args...)
+			},
+			Grinders: []grinder.Func{func(ctxt *grinder.Context, pkg *grinder.Package) {
+				grinder.GrindFuncDecls(ctxt, pkg, func(ctxt *grinder.Context, pkg *grinder.Package, edit *grinder.EditBuffer, fn *ast.FuncDecl) {
+					fmt.Fprintf(&buf, "func %s\n", fn.Name.Name)
+					buf.Write(dump(pkg, Compute(pkg.FileSet, &pkg.Info, fn)))
+				})
+			}},
+		}
+		if pkg := ctxt.GrindFiles(file); pkg == nil || ctxt.Errors {
+			t.Errorf("%s: grind failed:\n%s", file, buf.String())
+			continue
+		}
+		base := strings.TrimSuffix(file, ".go")
+		golden, _ := ioutil.ReadFile(base + ".live")
+		if bytes.Equal(buf.Bytes(), golden) {
+			continue
+		}
+		ioutil.WriteFile(base+".live.xxx", buf.Bytes(), 0666)
+		t.Errorf("%s: wrong liveness; have %s.live.xxx, want %s.live", file, base, base)
+	}
+}
+
+// dump prints the live-in and live-out sets of the nodes in l,
+// in source order.
+func dump(pkg *grinder.Package, l *Info) []byte {
+	var nodes []ast.Node
+	for x := range l.in {
+		if x.Pos().IsValid() {
+			nodes = append(nodes, x)
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].Pos() != nodes[j].Pos() {
+			return nodes[i].Pos() < nodes[j].Pos()
+		}
+		return nodes[i].End() > nodes[j].End()
+	})
+	var buf bytes.Buffer
+	for _, x := range nodes {
+		pos := pkg.FileSet.Position(x.Pos())
+		var what string
+		switch x := x.(type) {
+		case *ast.Ident:
+			what = x.Name
+		case *ast.BlockStmt:
+			what = "{"
+		case *ast.DeclStmt:
+			what = "var"
+		}
+		fmt.Fprintf(&buf, "\t%d:%d %s: in=%s out=%s\n", pos.Line, pos.Column, what, names(l.LiveIn(x)), names(l.LiveOut(x)))
+	}
+	return buf.Bytes()
+}
+
+func names(list []*types.Var) string {
+	var s []string
+	for _, v := range list {
+		s = append(s, v.Name())
+	}
+	return "[" + strings.Join(s, " ") + "]"
+}
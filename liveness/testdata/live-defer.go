@@ -0,0 +1,25 @@
+package p
+
+func recovers() (err error) {
+	defer func() {
+		if recover() != nil {
+			err = errBad
+		}
+	}()
+	err = nil
+	x := 1
+	if x > 0 {
+		panic(x)
+	}
+	return
+}
+
+func exits(x int) (y int) {
+	y = x
+	if x > 0 {
+		os.Exit(1)
+	}
+	return
+}
+
+var errBad error
@@ -0,0 +1,50 @@
+package p
+
+func loop(n int) int {
+	var x, y int
+	for i := 0; i < n; i++ {
+		x = i * 2
+		y += x
+	}
+	for j := 0; j < n; j++ {
+		use(x)
+		x = j
+	}
+	return y
+}
+
+func named() (r int) {
+	var t = 1
+	r = t
+	return
+}
+
+func addr() {
+	var a, b int
+	p := &a
+	*p = 1
+	b = 2
+	use(b)
+	use(a)
+}
+
+func closure() {
+	c := 0
+	f := func() { c++ }
+	c = 1
+	f()
+}
+
+type T struct{ n int }
+
+func (t *T) inc() { t.n++ }
+
+func method() {
+	var t T
+	t.inc()
+	var u T
+	u = T{}
+	use(u.n)
+}
+
+func use(int) {}
@@ -0,0 +1,96 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lsp
+
+import "strings"
+
+// A hunk records that lines [oldStart, oldEnd) of the old text
+// are replaced by lines [newStart, newEnd) of the new text.
+type hunk struct {
+	oldStart, oldEnd int
+	newStart, newEnd int
+}
+
+// maxDiffCells bounds the size of the table used by diffLines.
+// Larger differences are reported as a single hunk.
+const maxDiffCells = 4 << 20
+
+// splitLines splits s into lines, each including its trailing newline.
+func splitLines(s string) []string {
+	var lines []string
+	for s != "" {
+		i := strings.Index(s, "\n")
+		if i < 0 {
+			lines = append(lines, s)
+			break
+		}
+		lines = append(lines, s[:i+1])
+		s = s[i+1:]
+	}
+	return lines
+}
+
+// diffLines returns the hunks needed to turn old into new,
+// using a longest common subsequence of lines.
+func diffLines(old, new []string) []hunk {
+	// Trim common prefix and suffix.
+	lo := 0
+	for lo < len(old) && lo < len(new) && old[lo] == new[lo] {
+		lo++
+	}
+	oldHi, newHi := len(old), len(new)
+	for oldHi > lo && newHi > lo && old[oldHi-1] == new[newHi-1] {
+		oldHi--
+		newHi--
+	}
+	if lo == oldHi && lo == newHi {
+		return nil
+	}
+	a, b := old[lo:oldHi], new[lo:newHi]
+	if len(a)*len(b) > maxDiffCells {
+		return []hunk{{lo, oldHi, lo, newHi}}
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:].
+	lcs := make([][]int32, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var hunks []hunk
+	var cur *hunk
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		if i < len(a) && j < len(b) && a[i] == b[j] {
+			cur = nil
+			i++
+			j++
+			continue
+		}
+		if cur == nil {
+			hunks = append(hunks, hunk{lo + i, lo + i, lo + j, lo + j})
+			cur = &hunks[len(hunks)-1]
+		}
+		if j >= len(b) || i < len(a) && lcs[i+1][j] >= lcs[i][j+1] {
+			i++
+			cur.oldEnd = lo + i
+		} else {
+			j++
+			cur.newEnd = lo + j
+		}
+	}
+	return hunks
+}
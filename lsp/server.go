@@ -0,0 +1,588 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package lsp implements a language server that offers
+// grind's rewrites as diagnostics and code actions.
+//
+// The server speaks the Language Server Protocol over a
+// JSON-RPC 2.0 stream, typically standard input and output.
+// For each open Go file it publishes one diagnostic per pending
+// rewrite, once the file has been left unchanged for a short delay,
+// offers an "Apply grind: ..." code action for each kind
+// of rewrite, and implements the grind.file command, which
+// applies all grinders to a file.
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"rsc.io/grind/grinder"
+)
+
+// CommandGrindFile is the command that grinds a whole file.
+// Its single argument is the URI of the file.
+const CommandGrindFile = "grind.file"
+
+// A Rewrite is a single kind of rewrite offered as a code action.
+type Rewrite struct {
+	Name  string // short description, such as "inline goto"
+	Grind grinder.Func
+}
+
+// DefaultDelay is the default for Server.Delay.
+const DefaultDelay = 500 * time.Millisecond
+
+// A Server is a language server.
+type Server struct {
+	Rewrites []Rewrite      // rewrites offered individually
+	Grinders []grinder.Func // grinders applied by CommandGrindFile
+	Logf     func(format string, args ...interface{})
+
+	// Verbose causes the server to log the passes
+	// and edits of every grind it runs, as grinder.Context.Verbose does.
+	Verbose bool
+
+	// Delay is how long a file must be left unchanged before
+	// its diagnostics are published. Zero means DefaultDelay.
+	Delay time.Duration
+
+	in     *bufio.Reader
+	out    io.Writer
+	wmu    sync.Mutex       // guards writes to out
+	mu     sync.Mutex       // guards fields below
+	files  map[string]*file // open files, by URI
+	dirty  map[string]bool  // files needing diagnostics
+	nextID int
+	kick   chan bool
+}
+
+type file struct {
+	text    string
+	version int        // incremented on every change to any open file
+	pending []*pending // computed lazily
+	done    bool
+	err     error
+}
+
+// A pending rewrite is a rewrite that applies to a file.
+type pending struct {
+	rewrite Rewrite
+	hunks   []hunk
+	old     []string // original file
+	lines   []string // rewritten file
+}
+
+// Serve reads requests from r and writes responses to w
+// until the client sends an exit notification or closes r.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.in = bufio.NewReader(r)
+	s.out = w
+	s.files = make(map[string]*file)
+	s.dirty = make(map[string]bool)
+	s.kick = make(chan bool, 1)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.publishLoop()
+	}()
+	defer func() {
+		close(s.kick)
+		wg.Wait()
+	}()
+
+	for {
+		msg, err := readMessage(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if _, ok := err.(*rpcError); ok {
+				s.logf("%v", err)
+				continue
+			}
+			return err
+		}
+		if msg.Method == "" {
+			// Response to a request we sent, such as workspace/applyEdit.
+			if msg.Error != nil {
+				s.logf("client error: %v", msg.Error)
+			}
+			continue
+		}
+		if msg.Method == "exit" {
+			return nil
+		}
+		result, err := s.handle(msg)
+		if msg.ID == nil {
+			if err != nil {
+				s.logf("%s: %v", msg.Method, err)
+			}
+			continue
+		}
+		reply := &message{ID: msg.ID}
+		if err != nil {
+			rerr, ok := err.(*rpcError)
+			if !ok {
+				rerr = &rpcError{codeInternalError, err.Error()}
+			}
+			reply.Error = rerr
+		} else if reply.Result, err = json.Marshal(result); err != nil {
+			return err
+		}
+		if err := s.write(reply); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) write(msg *message) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	return writeMessage(s.out, msg)
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.Logf != nil {
+		s.Logf(format, args...)
+	}
+}
+
+func (s *Server) handle(msg *message) (interface{}, error) {
+	switch msg.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":   1, // full
+				"codeActionProvider": true,
+				"executeCommandProvider": map[string]interface{}{
+					"commands": []string{CommandGrindFile},
+				},
+			},
+			"serverInfo": map[string]string{"name": "grind"},
+		}, nil
+
+	case "initialized", "$/cancelRequest", "$/setTrace", "textDocument/didSave":
+		return nil, nil
+
+	case "shutdown":
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var p DidOpenParams
+		if err := unmarshal(msg.Params, &p); err != nil {
+			return nil, err
+		}
+		s.update(p.TextDocument.URI, p.TextDocument.Text)
+		return nil, nil
+
+	case "textDocument/didChange":
+		var p DidChangeParams
+		if err := unmarshal(msg.Params, &p); err != nil {
+			return nil, err
+		}
+		if len(p.ContentChanges) == 0 {
+			return nil, nil
+		}
+		// Full synchronization: the last change holds the whole text.
+		s.update(p.TextDocument.URI, p.ContentChanges[len(p.ContentChanges)-1].Text)
+		return nil, nil
+
+	case "textDocument/didClose":
+		var p DidCloseParams
+		if err := unmarshal(msg.Params, &p); err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		delete(s.files, p.TextDocument.URI)
+		delete(s.dirty, p.TextDocument.URI)
+		s.invalidate()
+		s.mu.Unlock()
+		return nil, s.notify("textDocument/publishDiagnostics", &PublishDiagnosticsParams{URI: p.TextDocument.URI, Diagnostics: []Diagnostic{}})
+
+	case "textDocument/codeAction":
+		var p CodeActionParams
+		if err := unmarshal(msg.Params, &p); err != nil {
+			return nil, err
+		}
+		return s.codeActions(p.TextDocument.URI, p.Range)
+
+	case "workspace/executeCommand":
+		var p ExecuteCommandParams
+		if err := unmarshal(msg.Params, &p); err != nil {
+			return nil, err
+		}
+		if p.Command != CommandGrindFile {
+			return nil, &rpcError{codeInvalidParams, "unknown command " + p.Command}
+		}
+		var uri string
+		if len(p.Arguments) != 1 || json.Unmarshal(p.Arguments[0], &uri) != nil {
+			return nil, &rpcError{codeInvalidParams, CommandGrindFile + " requires a file URI argument"}
+		}
+		return nil, s.grindFile(uri)
+	}
+
+	if msg.ID == nil {
+		return nil, nil // ignore unknown notifications
+	}
+	return nil, &rpcError{codeMethodNotFound, "method not found: " + msg.Method}
+}
+
+// update records new contents for the file with the given URI
+// and schedules the publication of its diagnostics.
+func (s *Server) update(uri, text string) {
+	s.mu.Lock()
+	s.invalidate()
+	s.files[uri] = &file{text: text}
+	s.dirty[uri] = true
+	s.mu.Unlock()
+	select {
+	case s.kick <- true:
+	default:
+	}
+}
+
+// invalidate discards the pending rewrites for all open files,
+// since any file can affect the type checking of the others.
+// The pending rewrites are recomputed only when next needed.
+// s.mu must be held.
+func (s *Server) invalidate() {
+	for _, f := range s.files {
+		f.version++
+		f.pending = nil
+		f.done = false
+		f.err = nil
+	}
+}
+
+// publishLoop publishes diagnostics for files that have changed,
+// once no file has changed for s.Delay.
+// It runs until s.kick is closed.
+func (s *Server) publishLoop() {
+	delay := s.Delay
+	if delay == 0 {
+		delay = DefaultDelay
+	}
+	timer := time.NewTimer(delay)
+	timer.Stop()
+	for {
+		select {
+		case _, ok := <-s.kick:
+			if !ok {
+				timer.Stop()
+				return
+			}
+			timer.Reset(delay)
+		case <-timer.C:
+			s.mu.Lock()
+			var uris []string
+			for uri := range s.dirty {
+				uris = append(uris, uri)
+			}
+			s.dirty = make(map[string]bool)
+			s.mu.Unlock()
+			for _, uri := range uris {
+				if err := s.publish(uri); err != nil {
+					s.logf("%v", err)
+				}
+			}
+		}
+	}
+}
+
+func unmarshal(data json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return &rpcError{codeInvalidParams, err.Error()}
+	}
+	return nil
+}
+
+func (s *Server) notify(method string, params interface{}) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return s.write(&message{Method: method, Params: data})
+}
+
+func (s *Server) request(method string, params interface{}) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.nextID++
+	id, _ := json.Marshal(s.nextID)
+	s.mu.Unlock()
+	return s.write(&message{ID: id, Method: method, Params: data})
+}
+
+// publish sends the diagnostics for the file with the given URI.
+func (s *Server) publish(uri string) error {
+	diags := []Diagnostic{}
+	list, err := s.pending(uri)
+	if err != nil {
+		if _, ok := err.(*rpcError); ok {
+			return nil // closed in the meantime
+		}
+		s.logf("%v", err)
+	}
+	for _, p := range list {
+		for _, h := range p.hunks {
+			diags = append(diags, p.diagnostic(h))
+		}
+	}
+	return s.notify("textDocument/publishDiagnostics", &PublishDiagnosticsParams{URI: uri, Diagnostics: diags})
+}
+
+func (p *pending) diagnostic(h hunk) Diagnostic {
+	return Diagnostic{
+		Range:    hunkRange(h, p.old),
+		Severity: SeverityInformation,
+		Source:   "grind",
+		Message:  p.rewrite.Name,
+	}
+}
+
+// hunkRange returns the range of old lines replaced by h.
+func hunkRange(h hunk, old []string) Range {
+	return Range{linePos(h.oldStart, old), linePos(h.oldEnd, old)}
+}
+
+// linePos returns the position of the start of the given line.
+// If the text does not end in a newline, the position of the
+// line after the last is the end of the last line.
+func linePos(line int, lines []string) Position {
+	if line == len(lines) && line > 0 {
+		last := lines[line-1]
+		if !strings.HasSuffix(last, "\n") {
+			n := 0 // UTF-16 code units
+			for _, r := range last {
+				n += utf16Len(r)
+			}
+			return Position{line - 1, n}
+		}
+	}
+	return Position{line, 0}
+}
+
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+// hunkEdits returns the edits that apply hunks from old to produce lines.
+func hunkEdits(hunks []hunk, old, lines []string) []TextEdit {
+	var edits []TextEdit
+	for _, h := range hunks {
+		edits = append(edits, TextEdit{hunkRange(h, old), strings.Join(lines[h.newStart:h.newEnd], "")})
+	}
+	return edits
+}
+
+// codeActions returns the code actions for the range r of the
+// file with the given URI. Each action applies only the hunks
+// of its rewrite that overlap r.
+func (s *Server) codeActions(uri string, r Range) ([]CodeAction, error) {
+	list, err := s.pending(uri)
+	if err != nil {
+		if _, ok := err.(*rpcError); ok {
+			return nil, err
+		}
+		s.logf("%v", err)
+	}
+	actions := []CodeAction{}
+	for _, p := range list {
+		var diags []Diagnostic
+		var hunks []hunk
+		for _, h := range p.hunks {
+			// Hunks are half-open line ranges; treat insertions as one line.
+			end := h.oldEnd
+			if end == h.oldStart {
+				end++
+			}
+			if h.oldStart <= r.End.Line && r.Start.Line < end {
+				diags = append(diags, p.diagnostic(h))
+				hunks = append(hunks, h)
+			}
+		}
+		if len(diags) == 0 {
+			continue
+		}
+		actions = append(actions, CodeAction{
+			Title:       "Apply grind: " + p.rewrite.Name,
+			Kind:        "refactor.rewrite",
+			Diagnostics: diags,
+			Edit:        &WorkspaceEdit{Changes: map[string][]TextEdit{uri: hunkEdits(hunks, p.old, p.lines)}},
+		})
+	}
+	title := "Grind whole file"
+	actions = append(actions, CodeAction{
+		Title:   title,
+		Kind:    "source",
+		Command: &Command{Title: title, Command: CommandGrindFile, Arguments: []interface{}{uri}},
+	})
+	return actions, nil
+}
+
+// pending returns the rewrites that apply to the file with the given URI.
+// The result is cached until the next change to an open file.
+func (s *Server) pending(uri string) ([]*pending, error) {
+	s.mu.Lock()
+	f := s.files[uri]
+	if f == nil {
+		s.mu.Unlock()
+		return nil, &rpcError{codeInvalidParams, "file not open: " + uri}
+	}
+	if f.done {
+		s.mu.Unlock()
+		return f.pending, f.err
+	}
+	version := f.version
+	texts := s.snapshot()
+	s.mu.Unlock()
+
+	var list []*pending
+	var firstErr error
+	for _, rw := range s.Rewrites {
+		old, new, err := s.grind(uri, texts, []grinder.Func{rw.Grind})
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		oldLines, lines := splitLines(old), splitLines(new)
+		if hunks := diffLines(oldLines, lines); len(hunks) > 0 {
+			list = append(list, &pending{rw, hunks, oldLines, lines})
+		}
+	}
+
+	s.mu.Lock()
+	if f.version == version {
+		f.pending, f.err, f.done = list, firstErr, true
+	}
+	s.mu.Unlock()
+	return list, firstErr
+}
+
+// snapshot returns the texts of all open files, by URI.
+// s.mu must be held.
+func (s *Server) snapshot() map[string]string {
+	texts := make(map[string]string)
+	for uri, f := range s.files {
+		texts[uri] = f.text
+	}
+	return texts
+}
+
+// grindFile applies all the server's grinders to the file
+// with the given URI and asks the client to apply the result.
+func (s *Server) grindFile(uri string) error {
+	s.mu.Lock()
+	if s.files[uri] == nil {
+		s.mu.Unlock()
+		return &rpcError{codeInvalidParams, "file not open: " + uri}
+	}
+	texts := s.snapshot()
+	s.mu.Unlock()
+	old, new, err := s.grind(uri, texts, s.Grinders)
+	if err != nil {
+		return err
+	}
+	oldLines, lines := splitLines(old), splitLines(new)
+	hunks := diffLines(oldLines, lines)
+	if len(hunks) == 0 {
+		return nil
+	}
+	return s.request("workspace/applyEdit", &ApplyWorkspaceEditParams{
+		Label: "grind whole file",
+		Edit:  WorkspaceEdit{Changes: map[string][]TextEdit{uri: hunkEdits(hunks, oldLines, lines)}},
+	})
+}
+
+// grind runs fns over the package containing the file with the given URI,
+// using texts, the contents of the open files, in place of the files on disk.
+// It returns the original and rewritten contents of the file.
+// A panic in a grinder is returned as an error.
+func (s *Server) grind(uri string, texts map[string]string, fns []grinder.Func) (old, new string, err error) {
+	name, err := uriToPath(uri)
+	if err != nil {
+		return "", "", err
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("grind %s: panic: %v", name, e)
+		}
+	}()
+	var buf bytes.Buffer
+	ctxt := &grinder.Context{
+		Grinders: fns,
+		Overlay:  make(map[string][]byte),
+		Verbose:  s.Verbose,
+		Logf: func(format string, args ...interface{}) {
+			fmt.Fprintf(&buf, format+"\n", args...)
+			if s.Verbose {
+				s.logf(format, args...)
+			}
+		},
+	}
+	for u, text := range texts {
+		if path, err := uriToPath(u); err == nil {
+			ctxt.Overlay[path] = []byte(text)
+		}
+	}
+
+	pkg := ctxt.GrindPackage(filepath.Dir(name))
+	if pkg == nil || ctxt.Errors || !hasFile(pkg, name) {
+		// Not part of an ordinary package (a test file, perhaps).
+		// Grind the file by itself.
+		buf.Reset()
+		ctxt.Errors = false
+		pkg = ctxt.GrindFiles(name)
+	}
+	if pkg == nil || ctxt.Errors {
+		return "", "", fmt.Errorf("grind %s:\n%s", name, buf.String())
+	}
+	return pkg.OrigSrc(name), pkg.Src(name), nil
+}
+
+func hasFile(pkg *grinder.Package, name string) bool {
+	for _, f := range pkg.Filenames {
+		if filepath.Clean(f) == name {
+			return true
+		}
+	}
+	return false
+}
+
+func uriToPath(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "file" {
+		return "", fmt.Errorf("unsupported URI %s", uri)
+	}
+	return filepath.Clean(filepath.FromSlash(u.Path)), nil
+}
+
+// PathToURI returns the file URI for the named file.
+func PathToURI(name string) string {
+	if abs, err := filepath.Abs(name); err == nil {
+		name = abs
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(name)}).String()
+}
@@ -0,0 +1,300 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"rsc.io/grind/gotoinline"
+	"rsc.io/grind/grinder"
+	"rsc.io/grind/vardecl"
+)
+
+// A client is an in-process LSP client connected to a Server.
+type client struct {
+	t     *testing.T
+	w     io.WriteCloser
+	r     *bufio.Reader
+	id    int
+	notes []*message // notifications and requests from the server
+	done  chan error
+}
+
+func newClient(t *testing.T, s *Server) *client {
+	sr, cw := io.Pipe()
+	cr, sw := io.Pipe()
+	c := &client{t: t, w: cw, r: bufio.NewReader(cr), done: make(chan error, 1)}
+	go func() {
+		err := s.Serve(sr, sw)
+		sw.Close()
+		c.done <- err
+	}()
+	return c
+}
+
+func (c *client) send(msg *message) {
+	if err := writeMessage(c.w, msg); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *client) read() *message {
+	msg, err := readMessage(c.r)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return msg
+}
+
+func marshal(t *testing.T, v interface{}) json.RawMessage {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// call sends a request and returns the result of the matching response.
+// Requests from the server are answered with a true result.
+func (c *client) call(method string, params, result interface{}) {
+	c.id++
+	id := marshal(c.t, c.id)
+	c.send(&message{ID: id, Method: method, Params: marshal(c.t, params)})
+	for {
+		msg := c.read()
+		if msg.Method != "" {
+			c.notes = append(c.notes, msg)
+			if msg.ID != nil {
+				// Reply concurrently, as the server may be
+				// blocked writing its response to our request.
+				reply := &message{ID: msg.ID, Result: marshal(c.t, map[string]bool{"applied": true})}
+				go writeMessage(c.w, reply)
+			}
+			continue
+		}
+		if string(msg.ID) != string(id) {
+			c.t.Fatalf("%s: response for id %s, want %s", method, msg.ID, id)
+		}
+		if msg.Error != nil {
+			c.t.Fatalf("%s: %v", method, msg.Error)
+		}
+		if result != nil {
+			if err := json.Unmarshal(msg.Result, result); err != nil {
+				c.t.Fatalf("%s: %v", method, err)
+			}
+		}
+		return
+	}
+}
+
+func (c *client) notify(method string, params interface{}) {
+	c.send(&message{Method: method, Params: marshal(c.t, params)})
+}
+
+// next returns the next notification or request from the server with the given method.
+func (c *client) next(method string) *message {
+	for len(c.notes) > 0 {
+		msg := c.notes[0]
+		c.notes = c.notes[1:]
+		if msg.Method == method {
+			return msg
+		}
+	}
+	for {
+		msg := c.read()
+		if msg.Method == method {
+			return msg
+		}
+	}
+}
+
+// applyEdits applies the edits to text, which must be ASCII.
+func applyEdits(text string, edits []TextEdit) string {
+	offset := func(p Position) int {
+		lines := splitLines(text)
+		n := 0
+		for _, l := range lines[:p.Line] {
+			n += len(l)
+		}
+		return n + p.Character
+	}
+	sort.Slice(edits, func(i, j int) bool {
+		return edits[i].Range.Start.Line > edits[j].Range.Start.Line
+	})
+	for _, e := range edits {
+		start, end := offset(e.Range.Start), offset(e.Range.End)
+		text = text[:start] + e.NewText + text[end:]
+	}
+	return text
+}
+
+// grind applies fns to file directly, for comparison with the server.
+func grind(t *testing.T, file string, fns ...grinder.Func) string {
+	ctxt := &grinder.Context{
+		Grinders: fns,
+		Logf:     t.Logf,
+	}
+	pkg := ctxt.GrindFiles(file)
+	if pkg == nil || ctxt.Errors {
+		t.Fatalf("grinding %s failed", file)
+	}
+	if !pkg.Modified(file) {
+		t.Fatalf("grinding %s made no changes", file)
+	}
+	return pkg.Src(file)
+}
+
+func TestServer(t *testing.T) {
+	const file = "testdata/p.go"
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := string(data)
+	uri := PathToURI(file)
+
+	s := &Server{
+		Rewrites: []Rewrite{
+			{Name: "inline goto", Grind: gotoinline.Grind},
+			{Name: "move declaration", Grind: vardecl.Grind},
+		},
+		Grinders: []grinder.Func{gotoinline.Grind, vardecl.Grind},
+		Logf:     t.Logf,
+		Delay:    time.Millisecond,
+	}
+	c := newClient(t, s)
+
+	var init struct {
+		Capabilities struct {
+			CodeActionProvider bool `json:"codeActionProvider"`
+		} `json:"capabilities"`
+	}
+	c.call("initialize", map[string]interface{}{}, &init)
+	if !init.Capabilities.CodeActionProvider {
+		t.Errorf("initialize: no codeActionProvider")
+	}
+	c.notify("initialized", map[string]interface{}{})
+
+	c.notify("textDocument/didOpen", &DidOpenParams{TextDocumentItem{URI: uri, LanguageID: "go", Text: text}})
+	var diags PublishDiagnosticsParams
+	if err := json.Unmarshal(c.next("textDocument/publishDiagnostics").Params, &diags); err != nil {
+		t.Fatal(err)
+	}
+	found := map[string]bool{}
+	for _, d := range diags.Diagnostics {
+		found[d.Message] = true
+	}
+	if diags.URI != uri || !found["inline goto"] || !found["move declaration"] {
+		t.Errorf("diagnostics = %+v, want inline goto and move declaration for %s", diags, uri)
+	}
+
+	var actions []CodeAction
+	c.call("textDocument/codeAction", &CodeActionParams{TextDocumentIdentifier{uri}, Range{Position{0, 0}, Position{len(splitLines(text)), 0}}}, &actions)
+	want := map[string]grinder.Func{
+		"Apply grind: inline goto":      gotoinline.Grind,
+		"Apply grind: move declaration": vardecl.Grind,
+	}
+	haveCommand := false
+	for _, a := range actions {
+		if a.Command != nil && a.Command.Command == CommandGrindFile {
+			haveCommand = true
+			continue
+		}
+		fn := want[a.Title]
+		if fn == nil || a.Edit == nil {
+			t.Errorf("unexpected code action %+v", a)
+			continue
+		}
+		delete(want, a.Title)
+		if have, want := applyEdits(text, a.Edit.Changes[uri]), grind(t, file, fn); have != want {
+			t.Errorf("%s: have:\n%s\nwant:\n%s", a.Title, have, want)
+		}
+	}
+	for title := range want {
+		t.Errorf("missing code action %q", title)
+	}
+	if !haveCommand {
+		t.Errorf("missing %s code action", CommandGrindFile)
+	}
+
+	// An action for a range covering one goto must leave the other alone.
+	actions = nil
+	c.call("textDocument/codeAction", &CodeActionParams{TextDocumentIdentifier{uri}, Range{Position{12, 0}, Position{12, 0}}}, &actions)
+	found = map[string]bool{}
+	for _, a := range actions {
+		if a.Title != "Apply grind: inline goto" {
+			continue
+		}
+		found[a.Title] = true
+		have := applyEdits(text, a.Edit.Changes[uri])
+		if !strings.Contains(have, "goto loop") || strings.Contains(have, "goto again") {
+			t.Errorf("%s for line 13 only: have:\n%s", a.Title, have)
+		}
+	}
+	if !found["Apply grind: inline goto"] {
+		t.Errorf("no inline goto action for line 13")
+	}
+
+	c.call("workspace/executeCommand", &ExecuteCommandParams{Command: CommandGrindFile, Arguments: []json.RawMessage{marshal(t, uri)}}, nil)
+	var apply ApplyWorkspaceEditParams
+	if err := json.Unmarshal(c.next("workspace/applyEdit").Params, &apply); err != nil {
+		t.Fatal(err)
+	}
+	if have, want := applyEdits(text, apply.Edit.Changes[uri]), grind(t, file, s.Grinders...); have != want {
+		t.Errorf("%s: have:\n%s\nwant:\n%s", CommandGrindFile, have, want)
+	}
+
+	c.call("shutdown", nil, nil)
+	c.notify("exit", nil)
+	if err := <-c.done; err != nil {
+		t.Errorf("Serve: %v", err)
+	}
+}
+
+func TestGrindPanic(t *testing.T) {
+	s := &Server{}
+	uri := PathToURI("testdata/p.go")
+	_, _, err := s.grind(uri, nil, []grinder.Func{func(*grinder.Context, *grinder.Package) {
+		panic("overlapping edits")
+	}})
+	if err == nil || !strings.Contains(err.Error(), "overlapping edits") {
+		t.Errorf("grind with panicking grinder: err = %v, want panic error", err)
+	}
+}
+
+func TestNoTrailingNewline(t *testing.T) {
+	old := splitLines("a\nb")
+	new := splitLines("a\nb\nc\n")
+	edits := hunkEdits(diffLines(old, new), old, new)
+	if have, want := applyEdits("a\nb", edits), "a\nb\nc\n"; have != want {
+		t.Errorf("edits %+v produce %q, want %q", edits, have, want)
+	}
+	want := Position{1, 1}
+	if len(edits) != 1 || edits[0].Range.End != want {
+		t.Errorf("edits = %+v, want one edit ending at %+v", edits, want)
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	old := splitLines("a\nb\nc\nd\ne\n")
+	new := splitLines("a\nx\nc\ne\nf\n")
+	have := diffLines(old, new)
+	want := []hunk{{1, 2, 1, 2}, {3, 4, 3, 3}, {5, 5, 4, 5}}
+	if len(have) != len(want) {
+		t.Fatalf("diffLines = %v, want %v", have, want)
+	}
+	for i := range have {
+		if have[i] != want[i] {
+			t.Fatalf("diffLines = %v, want %v", have, want)
+		}
+	}
+}
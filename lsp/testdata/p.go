@@ -0,0 +1,29 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package p
+
+func f() {
+	var i int
+	if b {
+		goto loop
+	}
+	if b {
+		goto again
+	}
+	return
+
+again:
+	use(2)
+	return
+
+loop:
+	for i = 0; i < 10; i++ {
+		use(i)
+	}
+}
+
+func use(int)
+
+var b bool
@@ -13,18 +13,38 @@ import (
 	"os/exec"
 	"strings"
 
-	_ "golang.org/x/tools/go/gcimporter"
+	"rsc.io/grind/constcond"
 	"rsc.io/grind/deadcode"
+	"rsc.io/grind/deadstore"
+	"rsc.io/grind/gotobreak"
+	"rsc.io/grind/gotoif"
 	"rsc.io/grind/gotoinline"
+	"rsc.io/grind/gotoloop"
 	"rsc.io/grind/grinder"
+	"rsc.io/grind/lsp"
 	"rsc.io/grind/vardecl"
 )
 
 var diff = flag.Bool("diff", false, "print diffs")
 var verbose = flag.Bool("v", false, "verbose")
+var lspFlag = flag.Bool("lsp", false, "run as a language server on standard input and output")
+var since = flag.String("since", "", "only grind functions changed since git `rev` (- reads a diff from stdin)")
+var statsFlag = flag.Bool("stats", false, "report the rewrites grind would make, without writing files")
+var format = flag.String("format", "text", "output `format` for -stats: text, csv, or json")
+var deadcodeFlag = flag.String("deadcode", "stmts", "dead code `mode`: stmts removes unreachable statements, report also lists unused declarations without rewriting, decls also deletes them")
+var lines = linesFlag{}
+var funcs funcsFlag
+
+func init() {
+	flag.Var(lines, "lines", "only grind functions overlapping `file.go:start-end` (repeatable)")
+	flag.Var(&funcs, "func", "only grind the function or method (T.Name) with this `name` (repeatable)")
+}
 
 func usage() {
-	fmt.Fprintf(os.Stderr, "usage: grind [-diff] [-v] packagepath... (or file...)\n")
+	fmt.Fprintf(os.Stderr, "usage: grind [-diff] [-v] [-deadcode=stmts|report|decls] [-since=rev] [-lines=file.go:start-end] [-func=name] packagepath... (or file...)\n")
+	fmt.Fprintf(os.Stderr, "       grind -stats [-format=text|csv|json] packagepath... (or file...)\n")
+	fmt.Fprintf(os.Stderr, "       grind -lsp\n")
+	fmt.Fprintf(os.Stderr, "       grind cfg -func=name [-format=dot|json|mermaid] [-annotate=live|reach] [-blocks] file.go...\n")
 	os.Exit(2)
 }
 
@@ -35,16 +55,93 @@ var ctxt = grinder.Context{
 func main() {
 	flag.Usage = usage
 	flag.Parse()
-	if flag.NArg() == 0 {
-		usage()
-	}
 
+	ctxt.Verbose = *verbose
 	ctxt.Grinders = []grinder.Func{
 		deadcode.Grind,
+		constcond.Grind,
+		deadstore.Grind,
+		gotoloop.Grind,
+		gotobreak.Grind,
 		gotoinline.Grind,
+		gotoif.Grind,
 		vardecl.Grind,
 		DeleteUnusedLabels,
 	}
+	switch *deadcodeFlag {
+	case "stmts", "report":
+	case "decls":
+		ctxt.Grinders = append([]grinder.Func{deadcode.GrindDecls}, ctxt.Grinders...)
+	default:
+		log.Fatalf("unknown -deadcode %q: want stmts, report, or decls", *deadcodeFlag)
+	}
+
+	if *lspFlag {
+		server := &lsp.Server{
+			Rewrites: []lsp.Rewrite{
+				{Name: "remove dead code", Grind: deadcode.Grind},
+				{Name: "fold constant condition", Grind: constcond.Grind},
+				{Name: "remove dead store", Grind: deadstore.Grind},
+				{Name: "rewrite goto as loop", Grind: gotoloop.Grind},
+				{Name: "rewrite goto as break or continue", Grind: gotobreak.Grind},
+				{Name: "inline goto", Grind: gotoinline.Grind},
+				{Name: "rewrite goto as if", Grind: gotoif.Grind},
+				{Name: "move declaration", Grind: vardecl.Grind},
+				{Name: "delete unused label", Grind: DeleteUnusedLabels},
+			},
+			Grinders: ctxt.Grinders,
+			Logf:     log.Printf,
+			Verbose:  *verbose,
+		}
+		if err := server.Serve(os.Stdin, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	args := flag.Args()
+	if len(args) > 0 && args[0] == "cfg" {
+		if err := runCfg(os.Stdout, args[1:]); err != nil {
+			if err != flag.ErrHelp {
+				log.Print(err)
+			}
+			os.Exit(2)
+		}
+		return
+	}
+	if *statsFlag {
+		switch *format {
+		case "text", "csv", "json":
+		default:
+			log.Fatalf("unknown -format %q: want text, csv, or json", *format)
+		}
+	}
+	if *since != "" && len(lines) > 0 {
+		log.Fatal("-since and -lines cannot be used together")
+	}
+	if *since != "" {
+		changed, err := changedLines(*since)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ctxt.Lines = changed
+		if len(args) == 0 {
+			args = changedDirs(changed)
+			if len(args) == 0 {
+				return
+			}
+		}
+	}
+	if len(lines) > 0 {
+		ctxt.Lines = lines
+	}
+	if len(funcs) > 0 {
+		ctxt.Funcs = funcs
+	}
+
+	if len(args) == 0 {
+		usage()
+	}
 
 	defer func() {
 		if ctxt.Errors {
@@ -52,12 +149,24 @@ func main() {
 		}
 	}()
 
-	if strings.HasSuffix(flag.Arg(0), ".go") {
-		grind(ctxt.GrindFiles(flag.Args()...))
+	if *deadcodeFlag == "report" {
+		reportDecls(os.Stdout, args)
+		return
+	}
+
+	if *statsFlag {
+		if err := writeStats(os.Stdout, *format, stats(args)); err != nil {
+			ctxt.Errorf("%v", err)
+		}
+		return
+	}
+
+	if strings.HasSuffix(args[0], ".go") {
+		grind(ctxt.GrindFiles(args...))
 		return
 	}
 
-	for _, path := range flag.Args() {
+	for _, path := range args {
 		grind(ctxt.GrindPackage(path))
 	}
 }
@@ -0,0 +1,134 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"rsc.io/grind/grinder"
+)
+
+// changedLines returns the lines changed since rev, keyed by absolute file name.
+// If rev is "-", the unified diff is read from standard input instead of
+// running git diff, and its paths are taken relative to the current directory.
+func changedLines(rev string) (map[string][]grinder.LineRange, error) {
+	var data []byte
+	var root string
+	var err error
+	if rev == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		root, err = os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		out, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+		if err != nil {
+			return nil, fmt.Errorf("git rev-parse: %v", err)
+		}
+		root = strings.TrimSpace(string(out))
+		cmd := exec.Command("git", "diff", "-U0", "--no-color", "--no-ext-diff", rev, "--", "*.go")
+		cmd.Dir = root
+		cmd.Stderr = os.Stderr
+		data, err = cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("git diff %s: %v", rev, err)
+		}
+	}
+	return parseDiff(bytes.NewReader(data), root)
+}
+
+// parseDiff parses a unified diff and returns the changed line ranges
+// of the new version of each file, with file names joined to root.
+// A pure deletion is recorded as touching the lines on either side of it.
+func parseDiff(r io.Reader, root string) (map[string][]grinder.LineRange, error) {
+	lines := make(map[string][]grinder.LineRange)
+	file := ""
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+		switch {
+		case strings.HasPrefix(line, "+++ "):
+			name := strings.TrimPrefix(line, "+++ ")
+			if i := strings.Index(name, "\t"); i >= 0 {
+				name = name[:i]
+			}
+			if name == "/dev/null" {
+				file = ""
+				break
+			}
+			name = strings.TrimPrefix(name, "b/")
+			file = filepath.Join(root, filepath.FromSlash(name))
+			if lines[file] == nil {
+				lines[file] = []grinder.LineRange{}
+			}
+		case strings.HasPrefix(line, "@@ ") && file != "":
+			f := strings.Fields(line)
+			if len(f) < 3 || !strings.HasPrefix(f[2], "+") {
+				return nil, fmt.Errorf("diff line %d: malformed hunk header %q", n, line)
+			}
+			start, count, err := parseHunkRange(f[2][1:])
+			if err != nil {
+				return nil, fmt.Errorf("diff line %d: malformed hunk header %q", n, line)
+			}
+			r := grinder.LineRange{Start: start, End: start + count - 1}
+			if count == 0 {
+				r.End = start + 1
+			}
+			lines[file] = append(lines[file], r)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+// parseHunkRange parses a "start,count" or "start" hunk range.
+func parseHunkRange(s string) (start, count int, err error) {
+	count = 1
+	if i := strings.Index(s, ","); i >= 0 {
+		count, err = strconv.Atoi(s[i+1:])
+		if err != nil {
+			return
+		}
+		s = s[:i]
+	}
+	start, err = strconv.Atoi(s)
+	return
+}
+
+// changedDirs returns the sorted directories holding the changed files in lines.
+func changedDirs(lines map[string][]grinder.LineRange) []string {
+	seen := make(map[string]bool)
+	var dirs []string
+	for file, ranges := range lines {
+		dir := filepath.Dir(file)
+		if len(ranges) == 0 || seen[dir] {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			continue
+		}
+		seen[dir] = true
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	return dirs
+}
@@ -0,0 +1,62 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"rsc.io/grind/grinder"
+)
+
+const sinceDiff = `diff --git a/x/a.go b/x/a.go
+index 1111111..2222222 100644
+--- a/x/a.go
++++ b/x/a.go
+@@ -3 +3 @@ package x
+-	a := 1
++	a := 2
+@@ -10,2 +10,4 @@ func f() {
++	b()
++	c()
+@@ -20,3 +22,0 @@ func g() {
+-	d()
+diff --git a/x/gone.go b/x/gone.go
+deleted file mode 100644
+--- a/x/gone.go
++++ /dev/null
+@@ -1,3 +0,0 @@
+-package x
+diff --git a/y/new.go b/y/new.go
+new file mode 100644
+--- /dev/null
++++ b/y/new.go
+@@ -0,0 +1,5 @@
++package y
+`
+
+func TestParseDiff(t *testing.T) {
+	root := filepath.FromSlash("/root")
+	lines, err := parseDiff(strings.NewReader(sinceDiff), root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]grinder.LineRange{
+		filepath.Join(root, "x", "a.go"):   {{Start: 3, End: 3}, {Start: 10, End: 13}, {Start: 22, End: 23}},
+		filepath.Join(root, "y", "new.go"): {{Start: 1, End: 5}},
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("parseDiff:\nhave %v\nwant %v", lines, want)
+	}
+}
+
+func TestParseDiffMalformed(t *testing.T) {
+	_, err := parseDiff(strings.NewReader("+++ b/a.go\n@@ -1 +x @@\n"), "/")
+	if err == nil {
+		t.Errorf("parseDiff accepted malformed hunk header")
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"rsc.io/grind/deadcode"
+	"rsc.io/grind/gotoinline"
+	"rsc.io/grind/grinder"
+	"rsc.io/grind/vardecl"
+)
+
+// pkgStats summarizes the rewrites grind would make to a package.
+type pkgStats struct {
+	Package        string `json:"package"`
+	Gotos          int    `json:"gotos"`
+	InlinableGotos int    `json:"inlinable_gotos"`
+	DeadStmts      int    `json:"dead_stmts"`
+	MovableVars    int    `json:"movable_vars"`
+	UnusedLabels   int    `json:"unused_labels"`
+	LinesRemoved   int    `json:"lines_removed"`
+}
+
+var statsHeader = []string{"package", "gotos", "inlinable_gotos", "dead_stmts", "movable_vars", "unused_labels", "lines_removed"}
+
+func (s *pkgStats) fields() []string {
+	return []string{
+		s.Package,
+		strconv.Itoa(s.Gotos),
+		strconv.Itoa(s.InlinableGotos),
+		strconv.Itoa(s.DeadStmts),
+		strconv.Itoa(s.MovableVars),
+		strconv.Itoa(s.UnusedLabels),
+		strconv.Itoa(s.LinesRemoved),
+	}
+}
+
+func (s *pkgStats) add(t *pkgStats) {
+	s.Gotos += t.Gotos
+	s.InlinableGotos += t.InlinableGotos
+	s.DeadStmts += t.DeadStmts
+	s.MovableVars += t.MovableVars
+	s.UnusedLabels += t.UnusedLabels
+	s.LinesRemoved += t.LinesRemoved
+}
+
+// countStats returns a grinder that records the rewrites
+// applicable to the package in s without making any of them.
+func countStats(s *pkgStats) grinder.Func {
+	return func(ctxt *grinder.Context, pkg *grinder.Package) {
+		s.Package = pkg.ImportPath
+		grinder.GrindFuncDecls(ctxt, pkg, func(ctxt *grinder.Context, pkg *grinder.Package, edit *grinder.EditBuffer, fn *ast.FuncDecl) {
+			ast.Inspect(fn.Body, func(x ast.Node) bool {
+				if x, ok := x.(*ast.BranchStmt); ok && x.Tok == token.GOTO {
+					s.Gotos++
+				}
+				return true
+			})
+			s.UnusedLabels += len(unusedLabels(pkg, fn))
+		})
+		s.InlinableGotos = gotoinline.CountInlinable(ctxt, pkg)
+		s.DeadStmts = deadcode.Count(ctxt, pkg)
+		s.MovableVars = vardecl.CountMovable(ctxt, pkg)
+	}
+}
+
+// stats computes the statistics for the packages or files in args.
+// It grinds each package in memory to measure the lines removed,
+// but it writes no files.
+func stats(args []string) []*pkgStats {
+	var list []*pkgStats
+	run := func(load func(*grinder.Context) *grinder.Package) {
+		s := new(pkgStats)
+		count := ctxt
+		count.Grinders = []grinder.Func{countStats(s)}
+		pkg := load(&count)
+		if count.Errors {
+			ctxt.Errors = true
+		}
+		if pkg == nil {
+			return
+		}
+		if s.Package == "" {
+			// Grinder never ran, because the package failed to type check.
+			return
+		}
+		pkg = load(&ctxt)
+		if pkg == nil {
+			return
+		}
+		for _, name := range pkg.Filenames {
+			s.LinesRemoved += strings.Count(pkg.OrigSrc(name), "\n") - strings.Count(pkg.Src(name), "\n")
+		}
+		list = append(list, s)
+	}
+
+	if strings.HasSuffix(args[0], ".go") {
+		run(func(c *grinder.Context) *grinder.Package { return c.GrindFiles(args...) })
+		return list
+	}
+	for _, path := range args {
+		run(func(c *grinder.Context) *grinder.Package { return c.GrindPackage(path) })
+	}
+	return list
+}
+
+// writeStats writes list and its total to w in the given format:
+// text, csv, or json.
+func writeStats(w io.Writer, format string, list []*pkgStats) error {
+	total := &pkgStats{Package: "total"}
+	for _, s := range list {
+		total.add(s)
+	}
+
+	switch format {
+	case "text":
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintf(tw, "%s\n", strings.Join(statsHeader, "\t"))
+		for _, s := range append(list, total) {
+			fmt.Fprintf(tw, "%s\n", strings.Join(s.fields(), "\t"))
+		}
+		return tw.Flush()
+
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write(statsHeader)
+		for _, s := range append(list, total) {
+			cw.Write(s.fields())
+		}
+		cw.Flush()
+		return cw.Error()
+
+	case "json":
+		if list == nil {
+			list = []*pkgStats{}
+		}
+		data, err := json.MarshalIndent(struct {
+			Packages []*pkgStats `json:"packages"`
+			Total    *pkgStats   `json:"total"`
+		}{list, total}, "", "\t")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(data, '\n'))
+		return err
+	}
+	return fmt.Errorf("unknown stats format %q", format)
+}
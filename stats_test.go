@@ -0,0 +1,45 @@
+// Copyright 2015 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"rsc.io/grind/deadcode"
+	"rsc.io/grind/gotoinline"
+	"rsc.io/grind/grinder"
+	"rsc.io/grind/vardecl"
+)
+
+func TestStats(t *testing.T) {
+	old := ctxt
+	defer func() { ctxt = old }()
+	ctxt.Grinders = []grinder.Func{
+		deadcode.Grind,
+		gotoinline.Grind,
+		vardecl.Grind,
+		DeleteUnusedLabels,
+	}
+
+	list := stats([]string{"testdata/stats/a.go"})
+	if ctxt.Errors {
+		t.Fatal("stats failed")
+	}
+	var buf bytes.Buffer
+	if err := writeStats(&buf, "csv", list); err != nil {
+		t.Fatal(err)
+	}
+	want := "package,gotos,inlinable_gotos,dead_stmts,movable_vars,unused_labels,lines_removed\n" +
+		".,1,1,1,1,0,4\n" +
+		"total,1,1,1,1,0,4\n"
+	if have := buf.String(); have != want {
+		t.Errorf("stats:\nhave:\n%s\nwant:\n%s", have, want)
+	}
+
+	if err := writeStats(&buf, "xml", list); err == nil {
+		t.Errorf("writeStats accepted unknown format")
+	}
+}
@@ -0,0 +1,17 @@
+package a
+
+func F(n int) (sum int) {
+	for i := 0; i < n; i++ {
+		if i%2 == 0 {
+			continue
+		}
+		sum += i
+	}
+	return
+}
+
+type T struct{}
+
+func (T) G() {}
+
+func G() {}
@@ -0,0 +1,39 @@
+package p
+
+import "fmt"
+
+// Exported is exported, so it is never reported.
+func Exported() {
+	used()
+}
+
+func used() {}
+
+func unused() {
+	helper()
+}
+
+func helper() {
+	fmt.Println(limit)
+}
+
+func recursive(n int) int {
+	if n == 0 {
+		return 0
+	}
+	return recursive(n - 1)
+}
+
+type point struct{ x, y int }
+
+type shape interface{ area() float64 }
+
+type circle struct{ r float64 }
+
+func (c circle) area() float64 { return 3 * c.r * c.r }
+
+const limit = 10
+
+var Table = map[string]circle{}
+
+var counter int
@@ -0,0 +1,13 @@
+package stats
+
+func f(x int) int {
+	var y int
+	if x > 0 {
+		goto done
+	}
+	y = x * 2
+	return y
+	println("dead")
+done:
+	return 1
+}
@@ -13,20 +13,29 @@ import (
 
 func DeleteUnusedLabels(ctxt *grinder.Context, pkg *grinder.Package) {
 	grinder.GrindFuncDecls(ctxt, pkg, func(ctxt *grinder.Context, pkg *grinder.Package, edit *grinder.EditBuffer, fn *ast.FuncDecl) {
-		if fn.Body == nil {
-			return
+		for _, x := range unusedLabels(pkg, fn) {
+			edit.DeleteLine(x.Pos(), x.Colon+1)
 		}
-		blocks := block.Build(pkg.FileSet, fn.Body)
-		ast.Inspect(fn.Body, func(x ast.Node) bool {
-			switch x := x.(type) {
-			case *ast.LabeledStmt:
-				if len(blocks.Goto[x.Label.Name])+len(blocks.Break[x.Label.Name])+len(blocks.Continue[x.Label.Name]) == 0 {
-					edit.DeleteLine(x.Pos(), x.Colon+1)
-				}
-			case ast.Expr:
-				return false
+	})
+}
+
+// unusedLabels returns the labeled statements in fn whose labels are never used.
+func unusedLabels(pkg *grinder.Package, fn *ast.FuncDecl) []*ast.LabeledStmt {
+	if fn.Body == nil {
+		return nil
+	}
+	var list []*ast.LabeledStmt
+	blocks := block.Build(pkg.FileSet, fn.Body)
+	ast.Inspect(fn.Body, func(x ast.Node) bool {
+		switch x := x.(type) {
+		case *ast.LabeledStmt:
+			if len(blocks.Goto[x.Label.Name])+len(blocks.Break[x.Label.Name])+len(blocks.Continue[x.Label.Name]) == 0 {
+				list = append(list, x)
 			}
-			return true
-		})
+		case ast.Expr:
+			return false
+		}
+		return true
 	})
+	return list
 }
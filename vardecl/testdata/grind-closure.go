@@ -0,0 +1,31 @@
+package p
+
+func f() int {
+	var x int
+	x = 1
+	println(x)
+	x = 2
+	g := func() {
+		x++
+	}
+	g()
+	return x
+}
+
+func h() {
+	var y int
+	defer func() {
+		println(y)
+	}()
+	y = 1
+}
+
+func k() {
+	var z int
+	for i := 0; i < 10; i++ {
+		z = i
+		go func() {
+			println(z)
+		}()
+	}
+}
@@ -0,0 +1,29 @@
+package p
+
+type List[T any] struct {
+	next *List[T]
+	val  T
+}
+
+type Pair[K comparable, V any] struct {
+	Key K
+	Val V
+}
+
+func Sum[T ~int | ~float64](list []T) T {
+	var total T
+	var i int
+	for i = 0; i < len(list); i++ {
+		total += list[i]
+	}
+	return total
+}
+
+func (l *List[T]) Last() T {
+	var p *List[T]
+	p = l
+	for p.next != nil {
+		p = p.next
+	}
+	return p.val
+}
@@ -0,0 +1,18 @@
+package p
+
+type List[T any] struct {
+	next *List[T]
+	val  T
+}
+
+type Pair[K comparable, V any] struct {
+	Key K
+	Val V
+}
+
+func New[T any]() {
+	x := (*List[T])(nil)
+	y := Pair[string, T]{}
+	z := List[int]{}
+	_, _, _ = x, y, z
+}
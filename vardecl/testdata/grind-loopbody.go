@@ -0,0 +1,29 @@
+package p
+
+func f(n int) {
+	var x int
+	for i := 0; i < n; i++ {
+		x = i * 2
+		use(x)
+	}
+
+	var y int
+	for i := 0; i < n; i++ {
+		use(y)
+		y = i
+	}
+
+	var z int
+	for i := 0; i < n; i++ {
+		z = i
+		use(&z)
+	}
+
+	var w int
+	for i := 0; i < n; i++ {
+		w = i
+	}
+	use(w)
+}
+
+func use(interface{})
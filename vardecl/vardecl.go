@@ -9,23 +9,33 @@ import (
 	"fmt"
 	"go/ast"
 	"go/token"
+	"go/types"
 	"strings"
 
-	"golang.org/x/tools/go/types"
-
 	"rsc.io/grind/block"
 	"rsc.io/grind/flow"
 	"rsc.io/grind/grinder"
+	"rsc.io/grind/liveness"
 )
 
 func Grind(ctxt *grinder.Context, pkg *grinder.Package) {
 	grinder.GrindFuncDecls(ctxt, pkg, grindFunc)
 }
 
-func grindFunc(ctxt *grinder.Context, pkg *grinder.Package, edit *grinder.EditBuffer, fn *ast.FuncDecl) {
-	vars := analyzeFunc(pkg, edit, fn.Body)
-	// fmt.Printf("%s", vardecl.PrintVars(conf.Fset, vars))
-	for _, v := range vars {
+// CountMovable returns the number of var declarations in pkg
+// that Grind would move closer to their uses.
+func CountMovable(ctxt *grinder.Context, pkg *grinder.Package) int {
+	n := 0
+	grinder.GrindFuncDecls(ctxt, pkg, func(ctxt *grinder.Context, pkg *grinder.Package, edit *grinder.EditBuffer, fn *ast.FuncDecl) {
+		n += len(movableVars(pkg, edit, fn))
+	})
+	return n
+}
+
+// movableVars returns the var declarations in fn that can be moved.
+func movableVars(pkg *grinder.Package, edit *grinder.EditBuffer, fn *ast.FuncDecl) []*Var {
+	var list []*Var
+	for _, v := range analyzeFunc(pkg, edit, fn) {
 		spec := v.Decl.Decl.(*ast.GenDecl).Specs[0].(*ast.ValueSpec)
 		if len(spec.Names) > 1 {
 			// TODO: Handle decls with multiple variables
@@ -35,6 +45,15 @@ func grindFunc(ctxt *grinder.Context, pkg *grinder.Package, edit *grinder.EditBu
 			// Declaration spans line. Maybe not great to move or duplicate?
 			continue
 		}
+		list = append(list, v)
+	}
+	return list
+}
+
+func grindFunc(ctxt *grinder.Context, pkg *grinder.Package, edit *grinder.EditBuffer, fn *ast.FuncDecl) {
+	// fmt.Printf("%s", vardecl.PrintVars(conf.Fset, vars))
+	for _, v := range movableVars(pkg, edit, fn) {
+		spec := v.Decl.Decl.(*ast.GenDecl).Specs[0].(*ast.ValueSpec)
 		keepDecl := false
 		for _, d := range v.Defs {
 			if d.Init == v.Decl {
@@ -48,7 +67,7 @@ func grindFunc(ctxt *grinder.Context, pkg *grinder.Package, edit *grinder.EditBu
 				edit.CopyLine(v.Decl.Pos(), v.Decl.End(), x.Semicolon)
 			case *ast.AssignStmt:
 				edit.Insert(x.TokPos, ":")
-				if !hasType(pkg, fn, x.Rhs[0], x.Lhs[0]) {
+				if !hasType(pkg, x.Rhs[0], x.Lhs[0]) {
 					typ := edit.TextAt(spec.Type.Pos(), spec.Type.End())
 					if strings.Contains(typ, " ") || typ == "interface{}" || typ == "struct{}" || strings.HasPrefix(typ, "*") {
 						typ = "(" + typ + ")"
@@ -68,27 +87,14 @@ func grindFunc(ctxt *grinder.Context, pkg *grinder.Package, edit *grinder.EditBu
 	}
 }
 
-func hasType(pkg *grinder.Package, fn *ast.FuncDecl, x, v ast.Expr) bool {
+func hasType(pkg *grinder.Package, x, v ast.Expr) bool {
 	// Does x (by itself) default to v's type?
-	// Find the scope in which x appears.
-	xScope := pkg.Info.Scopes[fn.Type]
-	ast.Inspect(fn.Body, func(z ast.Node) bool {
-		if z == nil {
-			return false
-		}
-		if x.Pos() < z.Pos() || z.End() <= x.Pos() {
-			return false
-		}
-		scope := pkg.Info.Scopes[z]
-		if scope != nil {
-			xScope = scope
-		}
-		return true
-	})
-	xt, err := types.EvalNode(pkg.FileSet, x, pkg.Types, xScope)
-	if err != nil {
+	// Check x alone in the scope where it appears.
+	info := &types.Info{Types: make(map[ast.Expr]types.TypeAndValue)}
+	if err := types.CheckExpr(pkg.FileSet, pkg.Types, x.Pos(), x, info); err != nil {
 		return false
 	}
+	xt := info.Types[x]
 	vt := pkg.Info.Types[v]
 	if types.Identical(xt.Type, vt.Type) {
 		return true
@@ -116,12 +122,12 @@ func hasType(pkg *grinder.Package, fn *ast.FuncDecl, x, v ast.Expr) bool {
 	return false
 }
 
-func analyzeFunc(pkg *grinder.Package, edit *grinder.EditBuffer, body *ast.BlockStmt) []*Var {
+func analyzeFunc(pkg *grinder.Package, edit *grinder.EditBuffer, fn *ast.FuncDecl) []*Var {
 	const debug = false
+	body := fn.Body
 
 	// Build list of candidate var declarations.
-	inClosure := make(map[*ast.Object]bool)
-	var objs []*ast.Object
+	var candidates []*ast.Object
 	vardecl := make(map[*ast.Object]*ast.DeclStmt)
 	ast.Inspect(body, func(x ast.Node) bool {
 		switch x := x.(type) {
@@ -136,20 +142,12 @@ func analyzeFunc(pkg *grinder.Package, edit *grinder.EditBuffer, body *ast.Block
 			}
 			for _, id := range spec.Names {
 				if id.Obj != nil {
-					objs = append(objs, id.Obj)
+					candidates = append(candidates, id.Obj)
 					vardecl[id.Obj] = x
 				}
 			}
 		case *ast.FuncLit:
-			ast.Inspect(x, func(x ast.Node) bool {
-				switch x := x.(type) {
-				case *ast.Ident:
-					if x.Obj != nil {
-						inClosure[x.Obj] = true
-					}
-				}
-				return true
-			})
+			// TODO: Handle variables declared in closures.
 			return false
 		}
 		return true
@@ -158,33 +156,41 @@ func analyzeFunc(pkg *grinder.Package, edit *grinder.EditBuffer, body *ast.Block
 	// Compute block information for entire AST.
 	blocks := block.Build(pkg.FileSet, body)
 
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	// Liveness tells which variables can move into loop bodies.
+	// It needs type information.
+	var live *liveness.Info
+	if pkg.TypesError == nil {
+		live = liveness.Compute(pkg.FileSet, &pkg.Info, fn)
+	}
+
+	// Find reaching definitions for all candidates at once.
+	// Variables shared with closures are treated as having their
+	// addresses taken at the point where the closure appears.
+	reach := flow.ReachingDefs(pkg.FileSet, body, candidates, func(x *ast.UnaryExpr) *ast.Object {
+		return addrOf(pkg, x)
+	})
+
 	var vars []*Var
 	// Handle each variable separately.
-	for _, obj := range objs {
-		// For now, refuse to touch variables shared with closures.
-		// Could instead treat those variables as having their addresses
-		// taken at the point where the closure appears in the source code.
-		if inClosure[obj] {
-			continue
+	for _, obj := range candidates {
+		refs := reach.Refs[obj]
+		after := func(x ast.Node) []ast.Node {
+			return reach.After(x, obj)
 		}
-		// Build flow graph of nodes relevant to v.
-		g := flow.Build(pkg.FileSet, body, func(x ast.Node) bool {
-			return needForObj(pkg, obj, x)
-		})
-
-		// Find reaching definitions.
-		m := newIdentMatcher(pkg, g, obj)
-		g.Dataflow(m)
 
 		// If an instance of v can refer to multiple definitions, merge them.
 		t := newUnionFind()
-		for _, x := range m.list {
-			for _, def := range m.out[x].list {
+		for _, x := range refs {
+			for _, def := range after(x) {
 				t.Add(def)
 			}
 		}
-		for _, x := range m.list {
-			defs := m.out[x].list
+		for _, x := range refs {
+			defs := after(x)
 			if len(defs) > 1 {
 				for _, def := range defs[1:] {
 					t.Merge(defs[0], def)
@@ -204,13 +210,12 @@ func analyzeFunc(pkg *grinder.Package, edit *grinder.EditBuffer, body *ast.Block
 
 		// Build map from uses to candidate definitions.
 		idToDef := make(map[ast.Node]*Def)
-		for _, x := range m.list {
+		for _, x := range refs {
 			if _, ok := x.(*ast.Ident); ok {
 				if debug {
-					fmt.Printf("ID:IN %s\n", m.nodeIn(x))
-					fmt.Printf("ID:OUT %s\n", m.nodeOut(x))
+					fmt.Printf("ID:OUT %s\n", nodeDefs(pkg.FileSet, x, after(x)))
 				}
-				defs := m.out[x].list
+				defs := after(x)
 				if len(defs) > 0 {
 					idToDef[x] = nodedef[t.Find(defs[0]).(ast.Node)]
 				}
@@ -219,7 +224,7 @@ func analyzeFunc(pkg *grinder.Package, edit *grinder.EditBuffer, body *ast.Block
 
 		// Compute start/end of where defn is needed,
 		// along with block where defn must be placed.
-		for _, x := range m.list {
+		for _, x := range refs {
 			// Skip declaration without initializer.
 			// We can move the zero initialization forward.
 			switch x := x.(type) {
@@ -231,7 +236,7 @@ func analyzeFunc(pkg *grinder.Package, edit *grinder.EditBuffer, body *ast.Block
 			// Must use all entries in list.
 			// Although most defs have been merged in previous passes,
 			// the implicit zero definition of a var decl has not been.
-			for _, def := range m.out[x].list {
+			for _, def := range after(x) {
 				d := nodedef[t.Find(def).(ast.Node)]
 				bx := blocks.Map[x]
 				if debug {
@@ -239,7 +244,7 @@ func analyzeFunc(pkg *grinder.Package, edit *grinder.EditBuffer, body *ast.Block
 					if d.Block != nil {
 						ddepth = d.Block.Depth
 					}
-					fmt.Printf("ID:X %s | d=%p %p b=%p bxdepth=%d ddepth=%d\n", m.nodeIn(x), d, d.Block, bx, bx.Depth, ddepth)
+					fmt.Printf("ID:X %s | d=%p %p b=%p bxdepth=%d ddepth=%d\n", nodeDefs(pkg.FileSet, x, after(x)), d, d.Block, bx, bx.Depth, ddepth)
 				}
 				if d.Block == nil {
 					d.Block = blocks.Map[x]
@@ -282,11 +287,15 @@ func analyzeFunc(pkg *grinder.Package, edit *grinder.EditBuffer, body *ast.Block
 				if d.Block == nil {
 					continue
 				}
-				// Cannot move declarations into loops.
-				// Without liveness analysis we cannot be sure the variable is dead on entry.
+				// Cannot move declarations into loops
+				// unless the variable is dead on entry to the loop body,
+				// so that each iteration can have its own.
 				for b := d.Block; b.Depth > orig; b = b.Parent {
 					switch b.Root.(type) {
 					case *ast.ForStmt, *ast.RangeStmt:
+						if d.Block != b && deadInLoop(live, b.Root, typesVar(pkg, vardecl[obj], obj)) {
+							break
+						}
 						for d.Block != b {
 							d.Start = d.Block.Root.Pos()
 							d.End = d.Block.Root.End()
@@ -301,8 +310,9 @@ func analyzeFunc(pkg *grinder.Package, edit *grinder.EditBuffer, body *ast.Block
 					label := blocks.Label[labelname]
 					for _, g := range list {
 						// Cannot declare between backward goto (possibly in nested block)
-						// and target label in same or outer block; without liveness information,
-						// we can't be sure the variable is dead at the label.
+						// and target label in same or outer block; liveness is computed
+						// for loop bodies, not labels, so we can't be sure the variable
+						// is dead at the label.
 						if vardecl[obj].Pos() < label.Pos() && label.Pos() < d.Start && d.Start < g.Pos() {
 							for label.Pos() < d.Block.Root.Pos() {
 								d.Block = d.Block.Parent
@@ -469,9 +479,9 @@ func analyzeFunc(pkg *grinder.Package, edit *grinder.EditBuffer, body *ast.Block
 			if debug {
 				fset := pkg.FileSet
 				fmt.Printf("\tdepth %d: %s:%d,%d (%d,%d)\n", d.Block.Depth, fset.Position(d.Start).Filename, fset.Position(d.Start).Line, fset.Position(d.End).Line, d.Start, d.End)
-				for _, x := range m.list {
-					if len(m.out[x].list) > 0 {
-						if d.Block == nodedef[t.Find(m.out[x].list[0]).(ast.Node)].Block {
+				for _, x := range refs {
+					if len(after(x)) > 0 {
+						if d.Block == nodedef[t.Find(after(x)[0]).(ast.Node)].Block {
 							fmt.Printf("\t%s:%d %T (%d)\n", fset.Position(x.Pos()).Filename, fset.Position(x.Pos()).Line, x, x.Pos())
 						}
 					}
@@ -671,120 +681,87 @@ func commonBlock(x, y *block.Block) *block.Block {
 	return x
 }
 
-// Because we don't have a proper liveness analysis, we don't know
-// which variables can be moved inside loop bodies and which cannot.
-// (We might also want escape analysis to avoid causing allocations.)
-// Move up to the outermost ForStmt if present.
-// (The ForStmt itself is not part of the looping control flow.)
-func outsideLoop(x *block.Block) *block.Block {
-	for y := x.Parent; y != nil; y = y.Parent {
-		switch y.Root.(type) {
-		case *ast.ForStmt, *ast.RangeStmt:
-			x = y
-		}
+// deadInLoop reports whether v is dead on entry to the body of loop,
+// according to live. Variables whose addresses are taken or that are
+// shared with closures are live everywhere, so they never move into
+// a loop, where each iteration might allocate a new one.
+func deadInLoop(live *liveness.Info, loop ast.Node, v *types.Var) bool {
+	if live == nil || v == nil {
+		return false
 	}
-	return x
+	var body *ast.BlockStmt
+	switch loop := loop.(type) {
+	case *ast.ForStmt:
+		body = loop.Body
+	case *ast.RangeStmt:
+		body = loop.Body
+	}
+	return !live.IsLiveIn(body, v)
 }
 
-func needForObj(pkg *grinder.Package, obj *ast.Object, x ast.Node) (need bool) {
-	switch x := x.(type) {
-	case *ast.Ident:
-		if x.Obj == obj {
-			return true
+// typesVar returns the variable obj declared by decl.
+func typesVar(pkg *grinder.Package, decl *ast.DeclStmt, obj *ast.Object) *types.Var {
+	for _, id := range decl.Decl.(*ast.GenDecl).Specs[0].(*ast.ValueSpec).Names {
+		if id.Obj == obj {
+			v, _ := pkg.Info.Defs[id].(*types.Var)
+			return v
 		}
+	}
+	return nil
+}
 
-	case *ast.UnaryExpr:
-		if x.Op == token.AND {
-			y := x.X
-			for {
-				switch yy := y.(type) {
-				case *ast.ParenExpr:
-					y = yy.X
-					continue
-				case *ast.SelectorExpr:
-					// If yy.X is a pointer, stop.
-					t := pkg.Info.Types[yy.X].Type
-					if t != nil {
-						t = t.Underlying()
-						if t == nil {
-							panic("underlying nil")
-						}
-						_, ok := t.(*types.Pointer)
-						if ok {
-							break
-						}
-					}
-					y = yy.X
-					continue
-				case *ast.IndexExpr:
-					// If yy.X is a pointer or slice, stop.
-					t := pkg.Info.Types[yy.X].Type
-					if t != nil {
-						t = t.Underlying()
-						if t == nil {
-							panic("underlying nil")
-						}
-						_, ok := t.(*types.Pointer)
-						if ok {
-							break
-						}
-						_, ok = t.(*types.Slice)
-						if ok {
-							break
-						}
-					}
-					y = yy.X
-					continue
+// addrOf returns the variable, if any, whose address is taken by x.
+// Taking the address of a field or array element takes the address of
+// the enclosing variable, but not when reached through a pointer or slice.
+func addrOf(pkg *grinder.Package, x *ast.UnaryExpr) *ast.Object {
+	y := x.X
+	for {
+		switch yy := y.(type) {
+		case *ast.ParenExpr:
+			y = yy.X
+			continue
+		case *ast.SelectorExpr:
+			// If yy.X is a pointer, stop.
+			t := pkg.Info.Types[yy.X].Type
+			if t != nil {
+				t = t.Underlying()
+				if t == nil {
+					panic("underlying nil")
 				}
-				break
-			}
-
-			switch y := y.(type) {
-			case *ast.Ident:
-				if y.Obj == obj {
-					return true
+				_, ok := t.(*types.Pointer)
+				if ok {
+					break
 				}
 			}
-		}
-
-	case *ast.DeclStmt:
-		g := x.Decl.(*ast.GenDecl)
-		if g.Tok != token.VAR {
-			break
-		}
-		for _, spec := range g.Specs {
-			vs := spec.(*ast.ValueSpec)
-			for _, id := range vs.Names {
-				if id.Obj == obj {
-					return true
+			y = yy.X
+			continue
+		case *ast.IndexExpr:
+			// If yy.X is a pointer or slice, stop.
+			t := pkg.Info.Types[yy.X].Type
+			if t != nil {
+				t = t.Underlying()
+				if t == nil {
+					panic("underlying nil")
 				}
-			}
-		}
-
-	case *ast.AssignStmt:
-		if x.Tok != token.ASSIGN {
-			break
-		}
-		for _, y := range x.Lhs {
-			y = unparen(y)
-			switch y := y.(type) {
-			case *ast.Ident:
-				if y.Obj == obj {
-					return true
+				_, ok := t.(*types.Pointer)
+				if ok {
+					break
+				}
+				_, ok = t.(*types.Slice)
+				if ok {
+					break
 				}
 			}
+			y = yy.X
+			continue
 		}
+		break
+	}
 
-	case *ast.IncDecStmt:
-		y := unparen(x.X)
-		switch y := y.(type) {
-		case *ast.Ident:
-			if y.Obj == obj {
-				return true
-			}
-		}
+	if y, ok := y.(*ast.Ident); ok {
+		return y.Obj
 	}
-	return false
+	return nil
 }
 
 func unparen(x ast.Expr) ast.Expr {
@@ -797,113 +774,16 @@ func unparen(x ast.Expr) ast.Expr {
 	}
 }
 
-type defSet struct {
-	list      []ast.Node
-	addrTaken bool
-}
-
-type identMatcher struct {
-	in   map[ast.Node]defSet
-	out  map[ast.Node]defSet
-	list []ast.Node
-	fset *token.FileSet
-	g    *flow.Graph
-	obj  *ast.Object
-	pkg  *grinder.Package
-}
-
-func newIdentMatcher(pkg *grinder.Package, g *flow.Graph, obj *ast.Object) *identMatcher {
-	return &identMatcher{
-		in:   make(map[ast.Node]defSet),
-		out:  make(map[ast.Node]defSet),
-		pkg:  pkg,
-		fset: pkg.FileSet,
-		g:    g,
-		obj:  obj,
-	}
-}
-
-func (m *identMatcher) nodeIn(x ast.Node) string {
-	var buf bytes.Buffer
-
-	fmt.Fprintf(&buf, "%s:", nodeLabel(m.fset, x))
-	for _, y := range m.in[x].list {
-		fmt.Fprintf(&buf, " %s", nodeLabel(m.fset, y))
-	}
-	return buf.String()
-}
-
-func (m *identMatcher) nodeOut(x ast.Node) string {
+func nodeDefs(fset *token.FileSet, x ast.Node, defs []ast.Node) string {
 	var buf bytes.Buffer
 
-	fmt.Fprintf(&buf, "%s:", nodeLabel(m.fset, x))
-	for _, y := range m.out[x].list {
-		fmt.Fprintf(&buf, " %s", nodeLabel(m.fset, y))
+	fmt.Fprintf(&buf, "%s:", nodeLabel(fset, x))
+	for _, y := range defs {
+		fmt.Fprintf(&buf, " %s", nodeLabel(fset, y))
 	}
 	return buf.String()
 }
 
-func (m *identMatcher) Init(x ast.Node) {
-	m.in[x] = defSet{}
-}
-
-func (m *identMatcher) Transfer(x ast.Node) {
-	if !needForObj(m.pkg, m.obj, x) {
-		m.out[x] = m.in[x]
-		return
-	}
-
-	_, ok := m.out[x]
-	if !ok && x != m.g.Start && x != m.g.End {
-		m.list = append(m.list, x)
-	}
-
-	switch x := x.(type) {
-	case *ast.Ident:
-		if len(m.in[x].list) == 1 && isDecl(m.in[x].list[0]) { // first use
-			m.out[x] = defSet{[]ast.Node{x}, false}
-			return
-		}
-
-	case *ast.DeclStmt:
-		m.out[x] = defSet{[]ast.Node{x}, false}
-		return
-
-	case *ast.UnaryExpr:
-		m.out[x] = defSet{m.in[x].list, true}
-		return
-
-	case *ast.AssignStmt:
-		if m.in[x].addrTaken {
-			m.out[x] = defSet{mergef(m.in[x].list, []ast.Node{x}), true}
-		} else {
-			m.out[x] = defSet{[]ast.Node{x}, false}
-		}
-		return
-
-	case *ast.IncDecStmt:
-		m.out[x] = defSet{mergef(m.in[x].list, []ast.Node{x}), m.in[x].addrTaken}
-		return
-	}
-	m.out[x] = m.in[x]
-}
-
-func isDecl(x ast.Node) bool {
-	_, ok := x.(*ast.DeclStmt)
-	return ok
-}
-
-func (m *identMatcher) Join(x, y ast.Node) bool {
-	dx := m.in[x]
-	dy := m.out[y]
-	new := mergef(dx.list, dy.list)
-	if len(new) > len(dx.list) || !dx.addrTaken && dy.addrTaken {
-		m.in[x] = defSet{new, dx.addrTaken || dy.addrTaken}
-		return true
-	}
-	return false
-}
-
 func nodeLabel(fset *token.FileSet, x ast.Node) string {
 	pos := fset.Position(x.Pos())
 	label := fmt.Sprintf("%T %s:%d", x, pos.Filename, pos.Line)
@@ -916,27 +796,6 @@ func nodeLabel(fset *token.FileSet, x ast.Node) string {
 	return label
 }
 
-func mergef(l1, l2 []ast.Node) []ast.Node {
-	if l1 == nil {
-		return l2
-	}
-	if l2 == nil {
-		return l1
-	}
-	var out []ast.Node
-	seen := map[ast.Node]bool{}
-	for _, x := range l1 {
-		out = append(out, x)
-		seen[x] = true
-	}
-	for _, x := range l2 {
-		if !seen[x] {
-			out = append(out, x)
-		}
-	}
-	return out
-}
-
 type unionFind struct {
 	parent map[interface{}]interface{}
 	rank   map[interface{}]int
@@ -1061,11 +920,9 @@ func isStructOrArrayLiteral(pkg *grinder.Package, edit *grinder.EditBuffer, x as
 	if !ok {
 		return "", false
 	}
-	t := tv.Type
-	if name, ok := t.(*types.Named); ok {
-		t = name.Underlying()
-	}
-	switch t.(type) {
+	// The underlying type of a type parameter is its constraint,
+	// so T{} for a type parameter T is left alone.
+	switch tv.Type.Underlying().(type) {
 	default:
 		return "", false
 	case *types.Struct, *types.Array: